@@ -0,0 +1,50 @@
+package gostatok
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestAdaptiveCompression(t *testing.T) {
+	c := newTestClient(t, Options{AdaptiveCompression: true})
+
+	compressWhole := func(data []byte) batchEncoding {
+		t.Helper()
+		bb := bytesBufferPool.Get()
+		bb.Reset()
+		bb.Write(data)
+
+		batch := c.compressWhole(bb)
+		defer bytesBufferPool.Put(batch.data)
+		if batch.encoding.content == CodecNone && !bytes.Equal(batch.data.Bytes(), data) {
+			t.Fatal("uncompressed batch differs from the serialized one")
+		}
+		return batch.encoding
+	}
+
+	compressible := bytes.Repeat([]byte(`1,http_requests,17,[{"t":1,"s":10,"c":1}]`), 100)
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	// The small batches aren't worth compressing
+	if encoding := compressWhole(compressible[:100]); encoding != (batchEncoding{CodecNone, CodecNone}) {
+		t.Fatalf("small batch is sent as %+v", encoding)
+	}
+	if encoding := compressWhole(compressible); encoding != (batchEncoding{CodecNone, CodecZstd}) {
+		t.Fatalf("compressible batch is sent as %+v", encoding)
+	}
+
+	// A poor ratio makes the next batches skip the compression for a while
+	if encoding := compressWhole(random); encoding != (batchEncoding{CodecNone, CodecNone}) {
+		t.Fatalf("incompressible batch is sent as %+v", encoding)
+	}
+	for i := range adaptiveCompressionSkipBatches {
+		if encoding := compressWhole(compressible); encoding.content != CodecNone {
+			t.Fatalf("batch #%d after a poor ratio is compressed", i)
+		}
+	}
+	if encoding := compressWhole(compressible); encoding.content != CodecZstd {
+		t.Fatalf("compression isn't resumed: %+v", encoding)
+	}
+}
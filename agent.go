@@ -0,0 +1,108 @@
+package gostatok
+
+import (
+	"net"
+
+	"github.com/statxyz/statok-go/agentproto"
+)
+
+// agentForwarder sends the events to the local aggregation agent instead of aggregating them,
+// see Options.AgentAddress
+type agentForwarder struct {
+	network string
+	address string
+
+	conn     net.Conn
+	datagram []byte
+
+	logger logger
+}
+
+// startAgentForwarder replaces the collector, serializer and sender when the client works through the agent
+func (c *Client) startAgentForwarder() {
+	defer close(c.collectorDone)
+
+	ticker := c.clock.NewTicker(FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry := <-c.eventsChan:
+			if entry.flushed != nil {
+				entry.flushed <- c.agent.flush()
+			} else if entry.batch != nil {
+				for _, e := range entry.batch {
+					c.agent.add(e)
+				}
+			} else {
+				c.agent.add(entry)
+			}
+		case <-ticker.C():
+			_ = c.agent.flush()
+		case <-c.stop:
+			_ = c.agent.flush()
+			if c.agent.conn != nil {
+				_ = c.agent.conn.Close()
+			}
+			return
+		}
+	}
+}
+
+func (a *agentForwarder) add(entry eventEntry) {
+	e := agentproto.Event{
+		Name:      entry.metricName,
+		LabelKeys: entry.labelKeys,
+		Labels:    entry.labels,
+	}
+	if entry.sampleRate < 1 {
+		e.SampleRate = entry.sampleRate
+	}
+	if entry.counter > 0 {
+		e.Counter = entry.counter
+	} else {
+		e.Value = entry.value
+		e.IsValue = true
+	}
+
+	prevLen := len(a.datagram)
+	datagram, err := agentproto.AppendEvent(a.datagram, e)
+	if err != nil {
+		return
+	}
+	a.datagram = datagram
+
+	if len(a.datagram) > agentproto.MaxDatagramSize {
+		line := append([]byte(nil), a.datagram[prevLen:]...)
+		a.datagram = a.datagram[:prevLen]
+		_ = a.flush()
+		a.datagram = append(a.datagram, line...)
+	}
+}
+
+func (a *agentForwarder) flush() error {
+	if len(a.datagram) == 0 {
+		return nil
+	}
+	defer func() {
+		a.datagram = a.datagram[:0]
+	}()
+
+	if a.conn == nil {
+		conn, err := net.Dial(a.network, a.address)
+		if err != nil {
+			a.logger.printf(LogLevelWarn, "statok: agent %s %s is unavailable: %v", a.network, a.address, err)
+			return err
+		}
+		a.conn = conn
+	}
+
+	if _, err := a.conn.Write(a.datagram); err != nil {
+		a.logger.printf(LogLevelWarn, "statok: failed to send to agent %s %s: %v", a.network, a.address, err)
+		_ = a.conn.Close()
+		// Redial on the next flush, e.g. if the agent was restarted
+		a.conn = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package gostatok
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/statxyz/statok-go/agentproto"
+)
+
+func TestAgentForwarder(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	conn, err := net.ListenPacket("unixgram", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c := NewClient(Options{AgentAddress: "unix://" + socket})
+	c.Event("jobs", 3, "cron")
+	c.EventValueLabels("duration", 1.5, L("job", "backup"))
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, agentproto.MaxDatagramSize)
+
+	var events []agentproto.Event
+	for len(events) < 2 {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := agentproto.DecodeDatagram(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, decoded...)
+	}
+
+	if e := events[0]; e.Name != "jobs" || e.Counter != 3 || e.IsValue || e.Labels[0] != "cron" {
+		t.Fatalf("unexpected counter event: %+v", e)
+	}
+	if e := events[1]; e.Name != "duration" || e.Value != 1.5 || !e.IsValue || e.LabelKeys[0] != "job" || e.Labels[0] != "backup" {
+		t.Fatalf("unexpected value event: %+v", e)
+	}
+}
+
+func TestAgentForwarderSampleRate(t *testing.T) {
+	a := &agentForwarder{}
+	a.add(eventEntry{metricName: "jobs", counter: 3, sampleRate: 0.25})
+	a.add(eventEntry{metricName: "duration", value: 2, sampleRate: 0.5})
+	a.add(eventEntry{metricName: "all", counter: 1, sampleRate: 1})
+
+	events, err := agentproto.DecodeDatagram(a.datagram)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The raw counters and values are sent with the rate, the agent scales them
+	expected := []agentproto.Event{
+		{Name: "jobs", Counter: 3, SampleRate: 0.25},
+		{Name: "duration", Value: 2, IsValue: true, SampleRate: 0.5},
+		{Name: "all", Counter: 1},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	for i, e := range expected {
+		if events[i].Name != e.Name || events[i].Counter != e.Counter || events[i].Value != e.Value ||
+			events[i].IsValue != e.IsValue || events[i].SampleRate != e.SampleRate {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], e)
+		}
+	}
+}
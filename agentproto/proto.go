@@ -0,0 +1,77 @@
+// Package agentproto is the datagram protocol between the clients and the local aggregation agent,
+// see cmd/statok-agent
+package agentproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// MaxDatagramSize is the max size of a datagram the clients send, it fits the default unix socket buffers
+const MaxDatagramSize = 8192
+
+// Event is a single event, encoded as a JSON line. A datagram consists of one or more lines.
+type Event struct {
+	Name      string   `json:"n"`
+	Counter   uint32   `json:"c,omitempty"`
+	Value     float32  `json:"v,omitempty"`
+	IsValue   bool     `json:"iv,omitempty"`
+	LabelKeys []string `json:"k,omitempty"`
+	Labels    []string `json:"l,omitempty"`
+	// SampleRate is the rate the client sampled the event at, 0 if it wasn't sampled.
+	// The counter and the value are sent as is, the agent scales them by the rate.
+	SampleRate float32 `json:"r,omitempty"`
+}
+
+// AppendEvent appends the encoded event line to the datagram
+func AppendEvent(datagram []byte, e Event) ([]byte, error) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return datagram, err
+	}
+	datagram = append(datagram, line...)
+	return append(datagram, '\n'), nil
+}
+
+// DecodeDatagram decodes the events of the datagram. The valid events are returned even if some lines
+// are malformed, the error tells how many were not.
+func DecodeDatagram(datagram []byte) ([]Event, error) {
+	var events []Event
+	invalid := 0
+	for _, line := range bytes.Split(datagram, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil || e.Name == "" {
+			invalid++
+			continue
+		}
+		events = append(events, e)
+	}
+
+	if invalid > 0 {
+		return events, fmt.Errorf("agentproto: %d malformed lines", invalid)
+	}
+	return events, nil
+}
+
+// ParseAddress parses the agent address, "unix:///path/to/socket" or "udp://host:port",
+// into the network and the address for net.Dial and net.ListenPacket
+func ParseAddress(address string) (network string, addr string, err error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch u.Scheme {
+	case "unix", "unixgram":
+		return "unixgram", u.Path, nil
+	case "udp":
+		return "udp", u.Host, nil
+	default:
+		return "", "", fmt.Errorf("agentproto: unsupported agent address %q, expected unix:///path or udp://host:port", address)
+	}
+}
@@ -9,12 +9,11 @@ import (
 const valuesDigestMaxValuesBeforeApprox = 32
 const valuesDigestResultRoundPrecision = 10
 
+// Percentiles are the default percentiles of the digests, as fractions
 var Percentiles = [...]float32{0.50, 0.75, 0.95, 0.99}
 
-const percentilesCount = len(Percentiles)
-
 type ValuesApproxDigest struct {
-	percentiles [percentilesCount]*Psqr
+	percentiles []*Psqr
 
 	min float32
 	max float32
@@ -32,11 +31,20 @@ func (vad *ValuesApproxDigest) Reset() {
 	vad.count = 0
 	vad.c = 0
 
-	for i, p := range Percentiles {
-		if vad.percentiles[i] == nil {
+	for _, p := range vad.percentiles {
+		p.Reset()
+	}
+}
+
+// setPercentiles resets the digest to estimate the percentiles, reusing the estimators of the same ones
+func (vad *ValuesApproxDigest) setPercentiles(percentiles []float32) {
+	vad.Reset()
+
+	vad.percentiles = slices.Grow(vad.percentiles[:0], len(percentiles))[:len(percentiles)]
+	for i, p := range percentiles {
+		if vad.percentiles[i] == nil || vad.percentiles[i].perc != p {
 			vad.percentiles[i] = NewPsqr(p)
 		}
-		vad.percentiles[i].Reset()
 	}
 }
 
@@ -63,8 +71,9 @@ func (vad *ValuesApproxDigest) Avg() float32 {
 }
 
 type ValuesDigest struct {
-	values []float32
-	approx *ValuesApproxDigest
+	percentiles []float32
+	values      []float32
+	approx      *ValuesApproxDigest
 }
 
 var (
@@ -75,7 +84,7 @@ var (
 		return &ValuesApproxDigest{}
 	})
 	valueValuesDigestsPool = commons.NewPool(func() []float32 {
-		return make([]float32, valuesDigestMaxValuesBeforeApprox)
+		return make([]float32, 0, valuesDigestMaxValuesBeforeApprox)
 	})
 )
 
@@ -86,16 +95,33 @@ func ReleaseValueDigest(digest *ValuesDigest) {
 	}
 }
 
+// NewValuesDigest returns a digest of the default Percentiles
 func NewValuesDigest() *ValuesDigest {
-	return valueDigestsPool.Get()
+	return NewValuesDigestPercentiles(nil)
 }
 
-func newValuesApproxDigest() *ValuesApproxDigest {
+// NewValuesDigestPercentiles returns a digest of the percentiles, fractions in (0, 1), or of the default
+// Percentiles if they are nil
+func NewValuesDigestPercentiles(percentiles []float32) *ValuesDigest {
+	vd := valueDigestsPool.Get()
+	if percentiles == nil {
+		percentiles = Percentiles[:]
+	}
+	vd.percentiles = percentiles
+	return vd
+}
+
+func newValuesApproxDigest(percentiles []float32) *ValuesApproxDigest {
 	approx := valueApproxDigestsPool.Get()
-	approx.Reset()
+	approx.setPercentiles(percentiles)
 	return approx
 }
 
+// Percentiles returns the percentiles of the digest, the last values of Result
+func (vd *ValuesDigest) Percentiles() []float32 {
+	return vd.percentiles
+}
+
 func (vd *ValuesDigest) Reset() {
 	valueValuesDigestsPool.Put(vd.values[:0])
 	vd.values = nil
@@ -110,7 +136,7 @@ func (vd *ValuesDigest) Add(value float32) {
 		vd.approx.Add(value)
 	} else {
 		if len(vd.values) >= valuesDigestMaxValuesBeforeApprox {
-			vd.approx = newValuesApproxDigest()
+			vd.approx = newValuesApproxDigest(vd.percentiles)
 			for _, v := range vd.values {
 				vd.approx.Add(v)
 			}
@@ -144,15 +170,15 @@ func (vd *ValuesDigest) Result(cb func(float32, int)) {
 		cb(float32(sum/float64(len(vd.values))), 0)
 		cb(vd.values[0], 1)
 		cb(vd.values[len(vd.values)-1], 2)
-		for i, p := range Percentiles {
+		for i, p := range vd.percentiles {
 			cb(percentile(vd.values, p), i+3)
 		}
 	} else {
 		cb(vd.approx.Avg(), 0)
 		cb(vd.approx.min, 1)
 		cb(vd.approx.max, 2)
-		for pi, _ := range Percentiles {
-			cb(vd.approx.percentiles[pi].Get(), pi+3)
+		for pi, p := range vd.approx.percentiles {
+			cb(p.Get(), pi+3)
 		}
 	}
 }
@@ -162,7 +188,8 @@ func round[T ~float32 | ~float64, V float64 | int | uint32 | uint](v T, precisio
 }
 
 func percentile(data []float32, p float32) float32 {
-	k := p / 100 * float32(len(data)-1)
+	// p is a fraction, like Percentiles
+	k := p * float32(len(data)-1)
 	f := int(k)
 	c := f + 1
 	if c > len(data)-1 {
@@ -0,0 +1,87 @@
+package approx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValuesDigestExact(t *testing.T) {
+	digest := NewValuesDigest()
+	defer ReleaseValueDigest(digest)
+
+	for v := 10; v >= 1; v-- {
+		digest.Add(float32(v))
+	}
+
+	want := []float32{5.5, 1, 10, 5.5, 7.75, 9.55, 9.91}
+	digest.Result(func(f float32, i int) {
+		if math.Abs(float64(f-want[i])) > 1e-5 {
+			t.Errorf("result #%d = %v, want %v", i, f, want[i])
+		}
+	})
+}
+
+func TestValuesDigestApprox(t *testing.T) {
+	digest := NewValuesDigest()
+	defer ReleaseValueDigest(digest)
+
+	for v := 1; v <= 1000; v++ {
+		digest.Add(float32(v))
+	}
+
+	digest.Result(func(f float32, i int) {
+		var want float32
+		switch i {
+		case 0:
+			want = 500.5
+		case 1:
+			want = 1
+		case 2:
+			want = 1000
+		default:
+			want = Percentiles[i-3] * 1000
+		}
+		if math.Abs(float64(f-want)) > 10 {
+			t.Errorf("result #%d = %v, want about %v", i, f, want)
+		}
+	})
+}
+
+func TestValuesDigestPercentiles(t *testing.T) {
+	percentiles := []float32{0.1, 0.9}
+	for _, count := range []int{10, 1000} {
+		digest := NewValuesDigestPercentiles(percentiles)
+
+		for v := 1; v <= count; v++ {
+			digest.Add(float32(v))
+		}
+
+		results := 0
+		digest.Result(func(f float32, i int) {
+			results++
+			if i < 3 {
+				return
+			}
+			want := percentiles[i-3] * float32(count)
+			if math.Abs(float64(f-want)) > float64(count)/50+1 {
+				t.Errorf("%d values: result #%d = %v, want about %v", count, i, f, want)
+			}
+		})
+		if results != 3+len(percentiles) {
+			t.Errorf("%d values: %d results, want %d", count, results, 3+len(percentiles))
+		}
+		ReleaseValueDigest(digest)
+	}
+
+	// The pooled digests get the default percentiles back
+	digest := NewValuesDigest()
+	defer ReleaseValueDigest(digest)
+	for v := 1; v <= 100; v++ {
+		digest.Add(float32(v))
+	}
+	results := 0
+	digest.Result(func(f float32, i int) { results++ })
+	if results != 3+len(Percentiles) {
+		t.Errorf("%d results of the default digest, want %d", results, 3+len(Percentiles))
+	}
+}
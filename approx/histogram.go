@@ -0,0 +1,71 @@
+package approx
+
+import (
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// HistogramSamples allocates up to maxSamples values to the histogram buckets, so the bucket values can be
+// reported as samples of the distribution. The samples are proportional to the bucket counts and exactly
+// min(total count, maxSamples) are allocated by the largest remainder method: the sparse buckets whose share
+// is below one sample get it only if their remainder is among the largest ones, so the tails keep their weight.
+func HistogramSamples(counts []uint64, maxSamples int) []int {
+	samples := make([]int, len(counts))
+
+	var total uint64
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 || maxSamples <= 0 {
+		return samples
+	}
+	budget := min(total, uint64(maxSamples))
+
+	remainders := make([]uint64, len(counts))
+	allocated := uint64(0)
+	for i, count := range counts {
+		// count * budget / total without the overflow, count <= total so the quotient fits
+		hi, lo := bits.Mul64(count, budget)
+		quotient, remainder := bits.Div64(hi, lo, total)
+		samples[i] = int(quotient)
+		remainders[i] = remainder
+		allocated += quotient
+	}
+
+	// The rest goes to the largest remainders, the earlier bucket wins the tie
+	order := make([]int, len(counts))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch {
+		case remainders[a] > remainders[b]:
+			return -1
+		case remainders[a] < remainders[b]:
+			return 1
+		default:
+			return 0
+		}
+	})
+	for _, i := range order[:budget-allocated] {
+		samples[i]++
+	}
+
+	return samples
+}
+
+// BucketMidpoint returns the value representing the bucket: the midpoint of its bounds, the finite bound
+// of a half-open bucket or 0 if both bounds are infinite
+func BucketMidpoint(lower, upper float64) float64 {
+	switch {
+	case math.IsInf(lower, -1) && math.IsInf(upper, 1):
+		return 0
+	case math.IsInf(lower, -1):
+		return upper
+	case math.IsInf(upper, 1):
+		return lower
+	default:
+		return (lower + upper) / 2
+	}
+}
@@ -0,0 +1,65 @@
+package approx
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestHistogramSamples(t *testing.T) {
+	tests := []struct {
+		name       string
+		counts     []uint64
+		maxSamples int
+		want       []int
+	}{
+		{"empty", []uint64{0, 0}, 10, []int{0, 0}},
+		{"below the limit", []uint64{3, 0, 2}, 10, []int{3, 0, 2}},
+		{"sparse tail", []uint64{1000, 0, 3, 1}, 10, []int{10, 0, 0, 0}},
+		{"largest remainders", []uint64{50, 30, 15, 5}, 7, []int{4, 2, 1, 0}},
+		{"ties", []uint64{1, 1, 1}, 2, []int{1, 1, 0}},
+		{"huge counts", []uint64{math.MaxUint64 / 2, math.MaxUint64 / 4}, 3, []int{2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HistogramSamples(tt.counts, tt.maxSamples)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistogramSamplesTotal(t *testing.T) {
+	// Many sparse buckets, like the scheduler latencies
+	counts := make([]uint64, 160)
+	for i := range counts {
+		counts[i] = uint64(i % 7)
+	}
+	counts[10] = 100000
+
+	for _, maxSamples := range []int{1, 17, 256, 1000} {
+		var sum int
+		for _, n := range HistogramSamples(counts, maxSamples) {
+			sum += n
+		}
+		if sum != maxSamples {
+			t.Fatalf("%d samples allocated, want %d", sum, maxSamples)
+		}
+	}
+}
+
+func TestBucketMidpoint(t *testing.T) {
+	inf := math.Inf(1)
+	for _, tt := range []struct{ lower, upper, want float64 }{
+		{1, 3, 2},
+		{-inf, 5, 5},
+		{5, inf, 5},
+		{-inf, inf, 0},
+	} {
+		if got := BucketMidpoint(tt.lower, tt.upper); got != tt.want {
+			t.Errorf("BucketMidpoint(%v, %v) = %v, want %v", tt.lower, tt.upper, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package gostatok
+
+import (
+	"context"
+	"time"
+)
+
+// BackpressurePolicy defines what happens with a new event when the events queue is full
+type BackpressurePolicy uint8
+
+const (
+	// BackpressureDrop drops the new event immediately and returns ErrDroppedEvent
+	BackpressureDrop BackpressurePolicy = iota
+	// BackpressureBlock waits until there is space in the queue or the context is done
+	BackpressureBlock
+	// BackpressureBlockWithTimeout waits up to Options.BackpressureTimeout, then drops the event
+	BackpressureBlockWithTimeout
+	// BackpressureDropOldest makes space for the new event by dropping the oldest queued one. A queued batch loses
+	// only as many of its oldest events as the new entry has, the rest of it is requeued.
+	BackpressureDropOldest
+)
+
+const defaultEventsBufferSize = 10000
+const defaultBackpressureTimeout = time.Millisecond * 100
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureDrop:
+		return "drop"
+	case BackpressureBlock:
+		return "block"
+	case BackpressureBlockWithTimeout:
+		return "block_with_timeout"
+	case BackpressureDropOldest:
+		return "drop_oldest"
+	default:
+		return "unknown"
+	}
+}
+
+func (c *Client) enqueue(ctx context.Context, entry eventEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+
+	select {
+	case c.eventsChan <- entry:
+		return nil
+	default:
+	}
+
+	switch c.backpressure {
+	case BackpressureBlock:
+		select {
+		case c.eventsChan <- entry:
+			return nil
+		case <-c.stop:
+			return ErrClientClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case BackpressureBlockWithTimeout:
+		timer := time.NewTimer(c.backpressureTimeout)
+		defer timer.Stop()
+
+		select {
+		case c.eventsChan <- entry:
+			return nil
+		case <-timer.C:
+			return ErrDroppedEvent
+		case <-c.stop:
+			return ErrClientClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case oldest := <-c.eventsChan:
+				if oldest.flushed != nil {
+					// The flush markers are not events, so it's requeued behind the new event
+					defer c.requeue(oldest)
+				} else if n := max(1, len(entry.batch)); len(oldest.batch) > n {
+					// Only as many events of the oldest batch are dropped as the new entry has
+					oldest.batch = oldest.batch[n:]
+					defer c.requeue(oldest)
+				}
+			default:
+			}
+
+			select {
+			case c.eventsChan <- entry:
+				return nil
+			default:
+			}
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+	default:
+		return ErrDroppedEvent
+	}
+}
+
+// requeue puts the entry taken out by BackpressureDropOldest back to the queue, waiting for space
+func (c *Client) requeue(entry eventEntry) {
+	select {
+	case c.eventsChan <- entry:
+	case <-c.stop:
+		if entry.flushed != nil {
+			entry.flushed <- ErrClientClosed
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package gostatok
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newBackpressureTestClient(t *testing.T, policy BackpressurePolicy, size int) *Client {
+	return newTestClient(t, Options{Backpressure: policy, EventsBufferSize: size, BackpressureTimeout: 10 * time.Millisecond})
+}
+
+func fillQueue(t *testing.T, c *Client) {
+	t.Helper()
+	for i := 0; i < cap(c.eventsChan); i++ {
+		if err := c.enqueue(context.Background(), eventEntry{metricName: "old"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBackpressureDrop(t *testing.T) {
+	c := newBackpressureTestClient(t, BackpressureDrop, 2)
+	fillQueue(t, c)
+	if err := c.enqueue(context.Background(), eventEntry{}); !errors.Is(err, ErrDroppedEvent) {
+		t.Fatalf("expected ErrDroppedEvent, got %v", err)
+	}
+}
+
+func TestBackpressureBlock(t *testing.T) {
+	c := newBackpressureTestClient(t, BackpressureBlock, 1)
+	fillQueue(t, c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.enqueue(ctx, eventEntry{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+
+	// Unblocked once the queue has space
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-c.eventsChan
+	}()
+	if err := c.enqueue(context.Background(), eventEntry{metricName: "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unblocked by Close
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(c.stop)
+	}()
+	if err := c.enqueue(context.Background(), eventEntry{}); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("expected ErrClientClosed, got %v", err)
+	}
+}
+
+func TestBackpressureBlockWithTimeout(t *testing.T) {
+	c := newBackpressureTestClient(t, BackpressureBlockWithTimeout, 1)
+	fillQueue(t, c)
+
+	start := time.Now()
+	if err := c.enqueue(context.Background(), eventEntry{}); !errors.Is(err, ErrDroppedEvent) {
+		t.Fatalf("expected ErrDroppedEvent, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < c.backpressureTimeout {
+		t.Fatalf("dropped after %s, before the timeout", elapsed)
+	}
+
+	c.backpressureTimeout = time.Minute
+	close(c.stop)
+	if err := c.enqueue(context.Background(), eventEntry{}); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("expected ErrClientClosed, got %v", err)
+	}
+}
+
+func TestBackpressureDropOldest(t *testing.T) {
+	c := newBackpressureTestClient(t, BackpressureDropOldest, 2)
+	fillQueue(t, c)
+
+	if err := c.enqueue(context.Background(), eventEntry{metricName: "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if first, second := <-c.eventsChan, <-c.eventsChan; first.metricName != "old" || second.metricName != "new" {
+		t.Fatalf("unexpected queue: %s, %s", first.metricName, second.metricName)
+	}
+}
+
+func TestBackpressureDropOldestBatch(t *testing.T) {
+	c := newBackpressureTestClient(t, BackpressureDropOldest, 2)
+	batch := make([]eventEntry, 5)
+	for i := range batch {
+		batch[i].metricName = string(rune('a' + i))
+	}
+	c.eventsChan <- eventEntry{batch: batch}
+	c.eventsChan <- eventEntry{metricName: "old"}
+
+	// The requeue of the rest of the batch waits for space
+	received := make(chan eventEntry, 3)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		for range 3 {
+			received <- <-c.eventsChan
+		}
+	}()
+
+	if err := c.enqueue(context.Background(), eventEntry{metricName: "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for range 3 {
+		e := <-received
+		if e.batch != nil {
+			for _, be := range e.batch {
+				names = append(names, be.metricName)
+			}
+		} else {
+			names = append(names, e.metricName)
+		}
+	}
+	if len(names) != 6 || names[0] != "old" || names[1] != "new" || names[2] != "b" {
+		t.Fatalf("expected only the oldest event of the batch to be dropped, got %v", names)
+	}
+}
+
+func TestEventsBufferSize(t *testing.T) {
+	for size, expected := range map[int]int{0: defaultEventsBufferSize, 5: 5} {
+		c := NewClient(Options{APIKey: "1_test", Endpoint: "http://127.0.0.1:1", EventsBufferSize: size})
+		if cap(c.eventsChan) != expected {
+			t.Errorf("EventsBufferSize %d: queue capacity %d, want %d", size, cap(c.eventsChan), expected)
+		}
+		_ = c.Close(context.Background())
+	}
+}
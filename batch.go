@@ -0,0 +1,119 @@
+package gostatok
+
+import (
+	"context"
+)
+
+// Max events in one queue entry for EventBatchPartial, so a single failed chunk doesn't drop the whole batch
+const batchPartialChunkSize = 256
+
+// BatchEvent is a single event of EventBatch, use CounterEvent and ValueEvent to make one
+type BatchEvent struct {
+	MetricName string
+	// LabelKeys are the keys of the named labels, nil for the positional labels.
+	// It must have the same length as Labels, see Labels.Split.
+	LabelKeys []string
+	Labels    []string
+	// Counter is the counter increment of a counter event, zero counters are ignored
+	Counter uint32
+	// Value is the value of a value event, used only when IsValue is set
+	Value   float32
+	IsValue bool
+	// SampleRate is the rate the event was already sampled at, e.g. by a client forwarding to the agent.
+	// Such an event is not sampled again, but scaled by the rate like the events sampled by the client.
+	// Zero means the client samples the event itself.
+	SampleRate float32
+}
+
+func CounterEvent(metricName string, value uint32, labels ...string) BatchEvent {
+	return BatchEvent{MetricName: metricName, Labels: labels, Counter: value}
+}
+
+func ValueEvent(metricName string, value float32, labels ...string) BatchEvent {
+	return BatchEvent{MetricName: metricName, Labels: labels, Value: value, IsValue: true}
+}
+
+// EventBatch enqueues all the events as one unit, which is aggregated in a single collector pass.
+// The batch is all-or-nothing: either every event is accepted, or none is and ErrDroppedEvent or
+// the *ValidationError of the first invalid event is returned. Events dropped by sampling count as accepted.
+func (c *Client) EventBatch(events []BatchEvent) error {
+	return c.EventBatchCtx(context.Background(), events)
+}
+
+// EventBatchCtx is like EventBatch, but waits for space in the events queue according to the backpressure
+// policy no longer than the context allows
+func (c *Client) EventBatchCtx(ctx context.Context, events []BatchEvent) error {
+	batch, err := c.makeBatch(events, c.clock.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return c.enqueue(ctx, eventEntry{batch: batch})
+}
+
+// EventBatchPartial enqueues the events in chunks, stopping at the first chunk which can't be enqueued or
+// has an invalid event.
+// It returns the number of leading events that were accepted, the rest of the events are dropped and
+// the error tells why.
+func (c *Client) EventBatchPartial(ctx context.Context, events []BatchEvent) (int, error) {
+	ts := c.clock.Now().Unix()
+
+	accepted := 0
+	for len(events) > 0 {
+		chunk := events[:min(len(events), batchPartialChunkSize)]
+
+		batch, err := c.makeBatch(chunk, ts)
+		if err != nil {
+			return accepted, err
+		}
+		if len(batch) > 0 {
+			if err := c.enqueue(ctx, eventEntry{batch: batch}); err != nil {
+				return accepted, err
+			}
+		}
+
+		accepted += len(chunk)
+		events = events[len(chunk):]
+	}
+
+	return accepted, nil
+}
+
+func (c *Client) makeBatch(events []BatchEvent, ts int64) ([]eventEntry, error) {
+	batch := make([]eventEntry, 0, len(events))
+	for _, e := range events {
+		if !e.IsValue && e.Counter == 0 {
+			continue
+		}
+
+		metricName, labelKeys, labels, err := c.validator.validate(e.MetricName, e.LabelKeys, e.Labels)
+		if err != nil {
+			return nil, err
+		}
+
+		rate, keep := normalizeSampleRate(float64(e.SampleRate)), true
+		if e.SampleRate == 0 {
+			rate, keep = c.sample(metricName)
+		}
+		if !keep {
+			continue
+		}
+
+		entry := eventEntry{
+			metricName: metricName,
+			labelKeys:  labelKeys,
+			labels:     labels,
+			ts:         ts,
+			sampleRate: rate,
+		}
+		if e.IsValue {
+			entry.value = e.Value
+		} else {
+			entry.counter = e.Counter
+		}
+		batch = append(batch, entry)
+	}
+	return batch, nil
+}
@@ -0,0 +1,103 @@
+package gostatok
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func counterEvents(n int) []BatchEvent {
+	events := make([]BatchEvent, n)
+	for i := range events {
+		events[i] = CounterEvent("m"+strconv.Itoa(i), 1)
+	}
+	return events
+}
+
+func TestEventBatch(t *testing.T) {
+	c := newTestClient(t, Options{EventsBufferSize: 1})
+
+	events := []BatchEvent{CounterEvent("hits", 1, "a"), CounterEvent("zero", 0), ValueEvent("latency", 1.5)}
+	if err := c.EventBatch(events); err != nil {
+		t.Fatal(err)
+	}
+	entry := <-c.eventsChan
+	if len(entry.batch) != 2 || entry.batch[0].counter != 1 || entry.batch[1].value != 1.5 {
+		t.Fatalf("unexpected batch, the zero counter must be skipped: %+v", entry.batch)
+	}
+}
+
+func TestEventBatchAllOrNothing(t *testing.T) {
+	c := newTestClient(t, Options{EventsBufferSize: 1})
+
+	events := counterEvents(3)
+	events[1].MetricName = "invalid name"
+	var validationErr *ValidationError
+	if err := c.EventBatch(events); !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if len(c.eventsChan) != 0 {
+		t.Fatal("events of the invalid batch were enqueued")
+	}
+
+	c.eventsChan <- eventEntry{}
+	if err := c.EventBatch(counterEvents(3)); !errors.Is(err, ErrDroppedEvent) {
+		t.Fatalf("expected ErrDroppedEvent for the full queue, got %v", err)
+	}
+}
+
+func TestEventBatchPartial(t *testing.T) {
+	c := newTestClient(t, Options{EventsBufferSize: 10})
+
+	accepted, err := c.EventBatchPartial(context.Background(), counterEvents(600))
+	if err != nil || accepted != 600 {
+		t.Fatalf("accepted %d, %v", accepted, err)
+	}
+	for _, expected := range []int{256, 256, 88} {
+		if entry := <-c.eventsChan; len(entry.batch) != expected {
+			t.Fatalf("chunk of %d events, want %d", len(entry.batch), expected)
+		}
+	}
+
+	// The chunk with the invalid event and the ones after it are dropped
+	events := counterEvents(600)
+	events[300].MetricName = ""
+	accepted, err = c.EventBatchPartial(context.Background(), events)
+	var validationErr *ValidationError
+	if accepted != 256 || !errors.As(err, &validationErr) {
+		t.Fatalf("accepted %d, %v", accepted, err)
+	}
+	<-c.eventsChan
+
+	c = newTestClient(t, Options{EventsBufferSize: 1})
+	accepted, err = c.EventBatchPartial(context.Background(), counterEvents(600))
+	if accepted != 256 || !errors.Is(err, ErrDroppedEvent) {
+		t.Fatalf("accepted %d, %v for the full queue", accepted, err)
+	}
+}
+
+func TestEventBatchSampleRate(t *testing.T) {
+	// The client would keep almost nothing of its own sampling
+	c := newTestClient(t, Options{EventsBufferSize: 1, SampleRate: 0.0001})
+
+	events := []BatchEvent{
+		{MetricName: "hits", Counter: 2, SampleRate: 0.25},
+		{MetricName: "latency", Value: 1.5, IsValue: true, SampleRate: 0.5},
+		{MetricName: "unsampled", Counter: 1, SampleRate: 1},
+	}
+	if err := c.EventBatch(events); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sampled events are not sampled again and keep their rates
+	entry := <-c.eventsChan
+	if len(entry.batch) != 3 {
+		t.Fatalf("expected 3 events, got %+v", entry.batch)
+	}
+	for i, rate := range []float32{0.25, 0.5, 1} {
+		if entry.batch[i].sampleRate != rate {
+			t.Errorf("event %s: sample rate %v, want %v", entry.batch[i].metricName, entry.batch[i].sampleRate, rate)
+		}
+	}
+}
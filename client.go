@@ -2,23 +2,32 @@ package gostatok
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/klauspost/compress/zstd"
+	"github.com/statxyz/statok-go/agentproto"
 	"github.com/statxyz/statok-go/approx"
 	"github.com/statxyz/statok-go/commons"
 	"log"
 	"math"
 	"net/http"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 var ErrDroppedEvent = errors.New("event dropped")
 
-const flushInterval = time.Millisecond * 333
+const sendTries = 3
+const defaultRetryDelay = time.Second * 5
+
+// FlushInterval is how often the ready accums are serialized and queued for sending
+const FlushInterval = time.Millisecond * 333
 
 type metric struct {
 	name   string
@@ -41,13 +50,17 @@ const StepsCount = len(Steps)
 type accum struct {
 	timeIndex int
 	step      Step
+	labelKeys []string
 	labels    []string
-	counter   uint32
-	digest    *approx.ValuesDigest
+	// The estimated real count of the events, scaled by the sample rates, rounded when serialized
+	counter float64
+	digest  *approx.ValuesDigest
+	// The lowest sample rate of the events accumulated, 1 if nothing was sampled out
+	sampleRate float32
 }
 
-func (a *accum) isReadyToSend() bool {
-	nowIndex := TimeToTimeIndex(time.Now().Unix(), a.step)
+func (a *accum) isReadyToSend(now int64) bool {
+	nowIndex := TimeToTimeIndex(now, a.step)
 	return a.timeIndex < nowIndex
 }
 
@@ -61,30 +74,176 @@ var (
 
 type eventEntry struct {
 	metricName string
+	// Keys of the named labels, nil for the positional labels
+	labelKeys  []string
 	labels     []string
 	value      float32
 	counter    uint32
 	ts         int64
+	sampleRate float32
+	// Non-nil for the batches enqueued by EventBatch, the other fields are unused then
+	batch []eventEntry
+	// Non-nil for the markers enqueued by Flush, the other fields are unused then
+	flushed chan error
+}
+
+// sendBatch is a serialized batch queued for sending
+type sendBatch struct {
+	data     *bytes.Buffer
+	encoding batchEncoding
+	// Receives the result of sending when the batch is sent by Flush, may be nil
+	flushed chan error
 }
 
 type Client struct {
 	apiKey   string
 	clientId int
+	// The part of apiKey after the client id, the key of the request signatures
+	apiSecret    string
+	signRequests bool
+
+	compressor    *compressor
+	compressBatch bool
+	// Non-nil if Options.AdaptiveCompression is set, guarded by metricAccumsMx
+	adaptive *adaptiveCompression
 
 	httpClient HTTPClient
-	endpoint   string
+	retryDelay time.Duration
+	clock      Clock
+
+	destinations             []*destination
+	destinationMode          DestinationMode
+	destinationProbeInterval time.Duration
 
 	eventsChan      chan eventEntry
 	metricAccumsMx  sync.Mutex
 	metricAccumsMap map[string]*metric
 
-	sendQueue chan *bytes.Buffer
+	sendQueue chan sendBatch
+
+	// Set by Close, closing stop makes the background goroutines exit
+	closed atomic.Bool
+	stop   chan struct{}
+	// Closed when the events collector, or the agent forwarder, has exited
+	collectorDone chan struct{}
+	// The number of the events collected since the last flush, see Close
+	unflushed atomic.Int64
+
+	sampleRateGlobal   float32
+	sampleRateByMetric map[string]float32
+	adaptiveSampling   bool
+
+	backpressure        BackpressurePolicy
+	backpressureTimeout time.Duration
+
+	validator validator
+
+	// Sorted subset of Steps, see Options.Steps
+	steps []Step
+	// The step of the digests exposed by PrometheusHandler, Step60s if it's enabled
+	promStep Step
+	// Sorted Options.Percentiles, nil for the default approx.Percentiles
+	percentiles []float32
+
+	// Cumulative state of the series for PrometheusHandler, nil unless Options.PrometheusExposition is set.
+	// Guarded by metricAccumsMx.
+	promSeries map[string]*promSeries
+
+	logger logger
+
+	// Non-nil if Options.SpoolDir is set in the failover mode, the fan-out destinations have their own
+	spool *spool
+
+	// Non-nil when the events are sent to the local agent, see Options.AgentAddress
+	agent *agentForwarder
 }
 
 type Options struct {
 	APIKey     string
 	HTTPClient HTTPClient
 	Endpoint   string
+
+	// Destinations are the endpoints to send the batches to instead of Endpoint, see DestinationMode
+	Destinations []string
+	// DestinationMode defines how the batches are sent to the Destinations, DestinationFailover by default
+	DestinationMode DestinationMode
+	// DestinationProbeInterval is how long a failing destination is skipped in the failover mode, 30 seconds by default
+	DestinationProbeInterval time.Duration
+
+	// SampleRate is the probability in (0, 1] with which an event is kept, e.g. 0.1 keeps 1 of 10 events.
+	// Zero means no sampling. Counters are scaled back by the rate, so they remain an estimate of the real value.
+	SampleRate float64
+	// MetricSampleRates overrides SampleRate for the specific metric names
+	MetricSampleRates map[string]float64
+	// AdaptiveSampling lowers the sample rate automatically while the events queue is under pressure,
+	// instead of dropping the events once it is full
+	AdaptiveSampling bool
+
+	// EventsBufferSize is the capacity of the events queue, 10000 by default
+	EventsBufferSize int
+	// Backpressure defines what happens with new events when the events queue is full, BackpressureDrop by default
+	Backpressure BackpressurePolicy
+	// BackpressureTimeout is the max wait time for BackpressureBlockWithTimeout, 100ms by default
+	BackpressureTimeout time.Duration
+
+	// Validation defines what happens with the events with invalid metric names or labels, ValidationReject by default
+	Validation ValidationPolicy
+	// MaxMetricNameLength is the max metric name length in bytes, 128 by default
+	MaxMetricNameLength int
+	// MaxLabels is the max number of labels of an event, 16 by default
+	MaxLabels int
+	// MaxLabelLength is the max label length in bytes, 256 by default
+	MaxLabelLength int
+
+	// Steps are the aggregation steps, all of Steps by default. The counters are accumulated only for the shortest one.
+	Steps []Step
+	// Percentiles are the percentiles of the values as fractions in (0, 1), approx.Percentiles by default.
+	// The other ones are sent in the accums, so the backend must support them.
+	Percentiles []float32
+
+	// PrometheusExposition keeps the cumulative state of every series for PrometheusHandler
+	PrometheusExposition bool
+
+	// AgentAddress makes the client send the events to the local aggregation agent (cmd/statok-agent)
+	// instead of aggregating and uploading them itself, e.g. "unix:///var/run/statok-agent.sock" or
+	// "udp://127.0.0.1:8126". APIKey and Endpoint are not used then.
+	AgentAddress string
+
+	// RetryDelay is the delay between the attempts to send a batch, 5 seconds by default
+	RetryDelay time.Duration
+
+	// Clock is the source of time, the system clock by default
+	Clock Clock
+
+	// Codec is the compression of the payloads, CodecZstd by default. The other codecs require a backend that
+	// reads HeaderFrameEncoding.
+	Codec Codec
+	// CompressionLevel is the zstd or gzip compression level, 0 for the default one
+	CompressionLevel int
+	// ZstdDictionary is the trained zstd dictionary, the backend must be configured with the same one
+	ZstdDictionary []byte
+	// CompressBatch compresses the whole batch once and advertises the Codec in Content-Encoding, instead of
+	// compressing the payload of every metric separately. It gives much better ratios for many small metrics.
+	CompressBatch bool
+	// AdaptiveCompression compresses the whole batch like CompressBatch, but sends the small batches and the ones
+	// which don't compress well uncompressed, and skips compressing the next batches for a while after a poor ratio.
+	// The encoding of every request is advertised in its headers.
+	AdaptiveCompression bool
+
+	// SpoolDir is the directory to keep the batches which could not be delivered after all the attempts. They are
+	// resent after the next successful send and on the start, the fan-out destinations use the subdirectories
+	// named by their index. The batches are kept as they are sent with their encoding, so a changed ZstdDictionary
+	// makes them undecodable.
+	SpoolDir string
+	// SpoolMaxBytes limits the size of the spooled batches, the oldest ones are removed above it, 64MB by default
+	SpoolMaxBytes int64
+
+	// LogLevel is the min level of the client log messages, LogLevelWarn by default
+	LogLevel LogLevel
+
+	// SignRequests sends the client id with a timestamp, a nonce and an HMAC-SHA256 signature of the request keyed
+	// with the secret part of APIKey instead of the APIKey itself, see Signature
+	SignRequests bool
 }
 
 //func NewClientWith(options Options) *Client {
@@ -92,36 +251,206 @@ type Options struct {
 //}
 
 func NewClient(options Options) *Client {
+	c := newClient(options)
+	c.start()
+	return c
+}
+
+// newClient creates the client without starting its goroutines
+func newClient(options Options) *Client {
 	if options.HTTPClient == nil {
 		options.HTTPClient = &http.Client{}
 	}
 
-	apiKeyParts := strings.Split(options.APIKey, "_")
-	if len(apiKeyParts) != 2 {
-		log.Fatalf("invalid api key: %s", options.APIKey)
+	var agent *agentForwarder
+	if options.AgentAddress != "" {
+		network, address, err := agentproto.ParseAddress(options.AgentAddress)
+		if err != nil {
+			log.Fatalf("invalid agent address: %v", err)
+		}
+		agent = &agentForwarder{network: network, address: address, logger: logger{options.LogLevel}}
+	}
+
+	var clientId int
+	var apiSecret string
+	if agent == nil {
+		apiKeyParts := strings.Split(options.APIKey, "_")
+		if len(apiKeyParts) != 2 {
+			log.Fatalf("invalid api key: %s", options.APIKey)
+		}
+		clientId, _ = strconv.Atoi(apiKeyParts[0])
+		apiSecret = apiKeyParts[1]
+	}
+
+	if options.Clock == nil {
+		options.Clock = systemClock{}
+	}
+	compressor, err := newCompressor(options.Codec, options.CompressionLevel, options.ZstdDictionary)
+	if err != nil {
+		log.Fatalf("invalid compression options: %v", err)
+	}
+
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = defaultRetryDelay
+	}
+	if options.DestinationProbeInterval <= 0 {
+		options.DestinationProbeInterval = defaultDestinationProbeInterval
+	}
+	if options.EventsBufferSize <= 0 {
+		options.EventsBufferSize = defaultEventsBufferSize
+	}
+	if options.BackpressureTimeout <= 0 {
+		options.BackpressureTimeout = defaultBackpressureTimeout
+	}
+	if options.MaxMetricNameLength <= 0 {
+		options.MaxMetricNameLength = defaultMaxMetricNameLength
+	}
+	if options.MaxLabels <= 0 {
+		options.MaxLabels = defaultMaxLabels
+	}
+	if options.MaxLabelLength <= 0 {
+		options.MaxLabelLength = defaultMaxLabelLength
+	}
+	if options.SpoolMaxBytes <= 0 {
+		options.SpoolMaxBytes = defaultSpoolMaxBytes
+	}
+
+	steps := Steps[:]
+	if len(options.Steps) > 0 {
+		steps = slices.Clone(options.Steps)
+		slices.Sort(steps)
+		steps = slices.Compact(steps)
+		for _, step := range steps {
+			if !slices.Contains(Steps[:], step) {
+				log.Fatalf("invalid step: %d", step)
+			}
+		}
+	}
+	promStep := steps[0]
+	if slices.Contains(steps, Step60s) {
+		promStep = Step60s
+	}
+
+	var percentiles []float32
+	if len(options.Percentiles) > 0 {
+		percentiles = slices.Clone(options.Percentiles)
+		slices.Sort(percentiles)
+		percentiles = slices.Compact(percentiles)
+		for _, p := range percentiles {
+			if !(p > 0 && p < 1) {
+				log.Fatalf("invalid percentile: %v", p)
+			}
+		}
+		if slices.Equal(percentiles, approx.Percentiles[:]) {
+			percentiles = nil
+		}
 	}
-	clientId, _ := strconv.Atoi(apiKeyParts[0])
 
 	c := &Client{
 		apiKey:          options.APIKey,
 		clientId:        clientId,
+		apiSecret:       apiSecret,
+		signRequests:    options.SignRequests,
+		compressor:      compressor,
+		compressBatch:   options.CompressBatch || options.AdaptiveCompression,
 		httpClient:      options.HTTPClient,
+		retryDelay:      options.RetryDelay,
+		clock:           options.Clock,
 		metricAccumsMap: make(map[string]*metric),
-		eventsChan:      make(chan eventEntry, 10000),
-		sendQueue:       make(chan *bytes.Buffer, 10),
+		eventsChan:      make(chan eventEntry, options.EventsBufferSize),
+		sendQueue:       make(chan sendBatch, 10),
+		stop:            make(chan struct{}),
+		collectorDone:   make(chan struct{}),
+
+		sampleRateGlobal:   normalizeSampleRate(options.SampleRate),
+		sampleRateByMetric: make(map[string]float32, len(options.MetricSampleRates)),
+		adaptiveSampling:   options.AdaptiveSampling,
+
+		backpressure:        options.Backpressure,
+		backpressureTimeout: options.BackpressureTimeout,
+
+		validator: validator{
+			policy:              options.Validation,
+			maxMetricNameLength: options.MaxMetricNameLength,
+			maxLabels:           options.MaxLabels,
+			maxLabelLength:      options.MaxLabelLength,
+		},
+
+		steps:       steps,
+		promStep:    promStep,
+		percentiles: percentiles,
+
+		destinationMode:          options.DestinationMode,
+		destinationProbeInterval: options.DestinationProbeInterval,
+
+		logger: logger{options.LogLevel},
+		agent:  agent,
 	}
 
-	if options.Endpoint != "" {
-		c.endpoint = options.Endpoint
-	} else {
-		c.endpoint = "https://statok.dev0101.xyz"
+	if options.PrometheusExposition {
+		c.promSeries = make(map[string]*promSeries)
+	}
+	if options.AdaptiveCompression {
+		c.adaptive = &adaptiveCompression{}
+	}
+
+	for name, rate := range options.MetricSampleRates {
+		c.sampleRateByMetric[name] = normalizeSampleRate(rate)
+	}
+
+	endpoints := options.Destinations
+	if len(endpoints) == 0 {
+		if options.Endpoint != "" {
+			endpoints = []string{options.Endpoint}
+		} else {
+			endpoints = []string{defaultEndpoint}
+		}
+	}
+	for _, endpoint := range endpoints {
+		d := newDestination(endpoint)
+		if c.destinationMode == DestinationFanOut {
+			d.queue = make(chan *sharedBatch, 10)
+		}
+		c.destinations = append(c.destinations, d)
+	}
+
+	if options.SpoolDir != "" && agent == nil {
+		newSpool := func(dir string) *spool {
+			s, err := newSpool(dir, options.SpoolMaxBytes, c.logger)
+			if err != nil {
+				c.logger.printf(LogLevelWarn, "statok: spool %s is disabled: %v", dir, err)
+				return nil
+			}
+			return s
+		}
+
+		if c.destinationMode == DestinationFanOut {
+			for i, d := range c.destinations {
+				d.spool = newSpool(filepath.Join(options.SpoolDir, strconv.Itoa(i)))
+			}
+		} else {
+			c.spool = newSpool(options.SpoolDir)
+		}
+	}
+
+	return c
+}
+
+func (c *Client) start() {
+	if c.agent != nil {
+		go c.startAgentForwarder()
+		return
 	}
 
 	go c.startEventsCollector()
 	go c.startSerializer()
 	go c.startSender()
 
-	return c
+	if c.destinationMode == DestinationFanOut {
+		for _, d := range c.destinations {
+			go c.startDestinationSender(d)
+		}
+	}
 }
 
 func (c *Client) Event(metricName string, value uint32, labels ...string) {
@@ -129,16 +458,13 @@ func (c *Client) Event(metricName string, value uint32, labels ...string) {
 }
 
 func (c *Client) EventWithError(metricName string, value uint32, labels ...string) error {
-	if value == 0 {
-		return nil
-	}
+	return c.EventCtx(context.Background(), metricName, value, labels...)
+}
 
-	select {
-	case c.eventsChan <- eventEntry{metricName, labels, 0, value, time.Now().Unix()}:
-	default:
-		return ErrDroppedEvent
-	}
-	return nil
+// EventCtx is like EventWithError, but waits for space in the events queue according to the backpressure
+// policy no longer than the context allows
+func (c *Client) EventCtx(ctx context.Context, metricName string, value uint32, labels ...string) error {
+	return c.enqueueCounter(ctx, metricName, nil, labels, value)
 }
 
 func (c *Client) EventValue(metricName string, value float32, labels ...string) {
@@ -146,75 +472,143 @@ func (c *Client) EventValue(metricName string, value float32, labels ...string)
 }
 
 func (c *Client) EventValueWithError(metricName string, value float32, labels ...string) error {
-	select {
-	case c.eventsChan <- eventEntry{metricName, labels, value, 0, time.Now().Unix()}:
-	default:
-		return ErrDroppedEvent
+	return c.EventValueCtx(context.Background(), metricName, value, labels...)
+}
+
+// EventValueCtx is like EventValueWithError, but waits for space in the events queue according to the
+// backpressure policy no longer than the context allows
+func (c *Client) EventValueCtx(ctx context.Context, metricName string, value float32, labels ...string) error {
+	return c.enqueueValue(ctx, metricName, nil, labels, value)
+}
+
+func (c *Client) enqueueCounter(ctx context.Context, metricName string, labelKeys, labels []string, value uint32) error {
+	if value == 0 {
+		return nil
 	}
-	return nil
+
+	metricName, labelKeys, labels, err := c.validator.validate(metricName, labelKeys, labels)
+	if err != nil {
+		return err
+	}
+
+	rate, keep := c.sample(metricName)
+	if !keep {
+		return nil
+	}
+
+	return c.enqueue(ctx, eventEntry{
+		metricName: metricName,
+		labelKeys:  labelKeys,
+		labels:     labels,
+		counter:    value,
+		ts:         c.clock.Now().Unix(),
+		sampleRate: rate,
+	})
+}
+
+func (c *Client) enqueueValue(ctx context.Context, metricName string, labelKeys, labels []string, value float32) error {
+	metricName, labelKeys, labels, err := c.validator.validate(metricName, labelKeys, labels)
+	if err != nil {
+		return err
+	}
+
+	rate, keep := c.sample(metricName)
+	if !keep {
+		return nil
+	}
+
+	return c.enqueue(ctx, eventEntry{
+		metricName: metricName,
+		labelKeys:  labelKeys,
+		labels:     labels,
+		value:      value,
+		ts:         c.clock.Now().Unix(),
+		sampleRate: rate,
+	})
 }
 
 func (c *Client) startEventsCollector() {
-	for entry := range c.eventsChan {
+	defer close(c.collectorDone)
+
+	for {
+		var entry eventEntry
+		select {
+		case entry = <-c.eventsChan:
+		case <-c.stop:
+			return
+		}
+
+		if entry.flushed != nil {
+			c.flushAccums(entry.flushed)
+			continue
+		}
+
 		func() {
 			c.metricAccumsMx.Lock()
 			defer c.metricAccumsMx.Unlock()
 
-			m := c.metricAccumsMap[entry.metricName]
-			if m == nil {
-				m = metricsPool.Get()
-				m.name = entry.metricName
-				c.metricAccumsMap[entry.metricName] = m
+			if entry.batch != nil {
+				for _, e := range entry.batch {
+					c.collectEvent(e)
+				}
+			} else {
+				c.collectEvent(entry)
 			}
+		}()
+		c.unflushed.Add(int64(max(1, len(entry.batch))))
+	}
+}
 
-			for _, step := range Steps {
-				if entry.counter != 0 {
-					// If the counter metric, then there is no need to accumulate values for anything other than 10 seconds
-					if step != Step10s {
-						continue
-					}
-				}
+// collectEvent accumulates the event into metricAccumsMap, metricAccumsMx must be held
+func (c *Client) collectEvent(entry eventEntry) {
+	m := c.metricAccumsMap[entry.metricName]
+	if m == nil {
+		m = metricsPool.Get()
+		m.name = entry.metricName
+		c.metricAccumsMap[entry.metricName] = m
+	}
 
-				timeIndex := TimeToTimeIndex(entry.ts, step)
+	for _, step := range c.steps {
+		if entry.counter != 0 {
+			// If the counter metric, then there is no need to accumulate values for anything other than the shortest step
+			if step != c.steps[0] {
+				continue
+			}
+		}
 
-				var acc *accum
-				for ai, a := range m.accums {
-					if a.step != step || a.timeIndex != timeIndex {
-						continue
-					}
-					if len(a.labels) != len(entry.labels) {
-						continue
-					}
-					isLabelsMatch := true
-					for i := range len(a.labels) {
-						if a.labels[i] != entry.labels[i] {
-							isLabelsMatch = false
-							break
-						}
-					}
+		timeIndex := TimeToTimeIndex(entry.ts, step)
 
-					if isLabelsMatch {
-						acc = &m.accums[ai]
-						break
-					}
-				}
+		var acc *accum
+		for ai, a := range m.accums {
+			if a.step != step || a.timeIndex != timeIndex {
+				continue
+			}
+			if slices.Equal(a.labels, entry.labels) && slices.Equal(a.labelKeys, entry.labelKeys) {
+				acc = &m.accums[ai]
+				break
+			}
+		}
 
-				if acc == nil {
-					m.accums = append(m.accums, accum{timeIndex, step, entry.labels, 0, nil})
-					acc = &m.accums[len(m.accums)-1]
-				}
+		if acc == nil {
+			m.accums = append(m.accums, accum{timeIndex, step, entry.labelKeys, entry.labels, 0, nil, 1})
+			acc = &m.accums[len(m.accums)-1]
+		}
 
-				if entry.counter > 0 {
-					acc.counter += entry.counter
-				} else {
-					acc.counter += 1
-					if acc.digest == nil {
-						acc.digest = approx.NewValuesDigest()
-					}
-					acc.digest.Add(entry.value)
-				}
+		acc.sampleRate = min(acc.sampleRate, entry.sampleRate)
+
+		if entry.counter > 0 {
+			acc.counter += scaleBySampleRate(entry.counter, entry.sampleRate)
+		} else {
+			acc.counter += scaleBySampleRate(1, entry.sampleRate)
+			if acc.digest == nil {
+				acc.digest = approx.NewValuesDigestPercentiles(c.percentiles)
 			}
-		}()
+			acc.digest.Add(entry.value)
+		}
+	}
+
+	if c.promSeries != nil {
+		c.collectPromSeries(entry)
 	}
 }
 
@@ -223,196 +617,310 @@ var bytesBufferPool = commons.NewPool(func() *bytes.Buffer {
 })
 
 func (c *Client) startSerializer() {
-	ticker := time.NewTicker(flushInterval)
+	ticker := c.clock.NewTicker(FlushInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		serialized := func() *bytes.Buffer {
+	for {
+		select {
+		case <-ticker.C():
+		case <-c.stop:
+			return
+		}
+
+		batch := func() sendBatch {
 			c.metricAccumsMx.Lock()
 			defer c.metricAccumsMx.Unlock()
 
-			if len(c.metricAccumsMap) == 0 {
-				return nil
-			}
+			return c.serializeAccums(false)
+		}()
 
-			bbTotal := bytesBufferPool.Get()
-			bbTotal.Reset()
+		if batch.data == nil {
+			continue
+		}
+		select {
+		case c.sendQueue <- batch:
+		case <-c.stop:
+			bytesBufferPool.Put(batch.data)
+			return
+		}
+	}
+}
 
-			// [LEN,CLIENT_ID,METRIC_NAME,[{s:60, t:999, l:["x","y","z"],c:222,v:[]}]]
+// serializeAccums serializes and removes the ready accums, or all of them if force is set,
+// metricAccumsMx must be held. The data of the batch is nil if nothing is serialized.
+func (c *Client) serializeAccums(force bool) sendBatch {
+	now := c.clock.Now().Unix()
+	isReady := func(a *accum) bool {
+		return force || a.isReadyToSend(now)
+	}
 
-			metricsSerializedCount := 0
-			for name, m := range c.metricAccumsMap {
-				bb := bytesBufferPool.Get()
-				bb.Reset()
+	if len(c.metricAccumsMap) == 0 {
+		return sendBatch{}
+	}
 
-				bb.WriteString(`[`)
+	bbTotal := bytesBufferPool.Get()
+	bbTotal.Reset()
 
-				ai := 0
-				for _, a := range m.accums {
-					if !a.isReadyToSend() {
-						continue
-					}
+	// [LEN,CLIENT_ID,METRIC_NAME,[{s:60, t:999, k:["a","b","c"], l:["x","y","z"],c:222,r:0.1,p:[0.9],v:[]}]]
 
-					if ai > 0 {
-						bb.WriteString(`,`)
-					}
-					bb.WriteString(`{"t":`)
+	metricsSerializedCount := 0
+	for name, m := range c.metricAccumsMap {
+		bb := bytesBufferPool.Get()
+		bb.Reset()
 
-					bb.WriteString(strconv.Itoa(a.timeIndex))
-					bb.WriteString(`,"s":`)
+		bb.WriteString(`[`)
 
-					bb.WriteString(strconv.Itoa(int(a.step)))
-					bb.WriteString(`,`)
+		ai := 0
+		for _, a := range m.accums {
+			if !isReady(&a) {
+				continue
+			}
 
-					if len(a.labels) > 0 {
-						bb.WriteString(`"l":[`)
-						for li, l := range a.labels {
-							if li > 0 {
-								bb.WriteString(`,`)
-							}
-							bb.WriteString(`"` + l + `"`)
-						}
-						bb.Cap()
-						bb.WriteString(`],`)
-					}
+			if ai > 0 {
+				bb.WriteString(`,`)
+			}
+			bb.WriteString(`{"t":`)
 
-					bb.WriteString(`"c":`)
-					bb.WriteString(strconv.Itoa(int(a.counter)))
-
-					if a.digest != nil {
-						bb.WriteString(`,"v":[`)
-						a.digest.Result(func(f float32, i int) {
-							if i > 0 {
-								bb.WriteString(`,`)
-							}
-							_, frac := math.Modf(float64(f))
-							if f > 999 || frac == 0.0 {
-								bb.WriteString(strconv.Itoa(int(f)))
-							} else {
-								bb.WriteString(fmt.Sprintf("%.1f", f))
-							}
-						})
-						bb.WriteString(`]`)
-					}
-					bb.WriteString(`}`)
+			bb.WriteString(strconv.Itoa(a.timeIndex))
+			bb.WriteString(`,"s":`)
+
+			bb.WriteString(strconv.Itoa(int(a.step)))
+			bb.WriteString(`,`)
 
-					ai++
+			if len(a.labelKeys) > 0 {
+				bb.WriteString(`"k":[`)
+				for ki, k := range a.labelKeys {
+					if ki > 0 {
+						bb.WriteString(`,`)
+					}
+					writeJSONString(bb, k)
 				}
+				bb.WriteString(`],`)
+			}
 
-				if ai == 0 {
-					bytesBufferPool.Put(bb)
-					continue
+			if len(a.labels) > 0 {
+				bb.WriteString(`"l":[`)
+				for li, l := range a.labels {
+					if li > 0 {
+						bb.WriteString(`,`)
+					}
+					writeJSONString(bb, l)
 				}
+				bb.WriteString(`],`)
+			}
 
+			bb.WriteString(`"c":`)
+			bb.WriteString(strconv.FormatUint(uint64(math.Round(a.counter)), 10))
+
+			if a.sampleRate < 1 {
+				bb.WriteString(`,"r":`)
+				bb.WriteString(strconv.FormatFloat(float64(a.sampleRate), 'g', -1, 32))
+			}
+
+			if a.digest != nil {
+				if c.percentiles != nil {
+					bb.WriteString(`,"p":[`)
+					for pi, p := range c.percentiles {
+						if pi > 0 {
+							bb.WriteString(`,`)
+						}
+						bb.WriteString(strconv.FormatFloat(float64(p), 'g', -1, 32))
+					}
+					bb.WriteString(`]`)
+				}
+				bb.WriteString(`,"v":[`)
+				a.digest.Result(func(f float32, i int) {
+					if i > 0 {
+						bb.WriteString(`,`)
+					}
+					_, frac := math.Modf(float64(f))
+					if f > 999 || frac == 0.0 {
+						bb.WriteString(strconv.Itoa(int(f)))
+					} else {
+						bb.WriteString(fmt.Sprintf("%.1f", f))
+					}
+				})
 				bb.WriteString(`]`)
+			}
+			bb.WriteString(`}`)
 
-				compressed := compressBuffer(bb)
+			ai++
+		}
 
-				bbTotal.WriteString(strconv.Itoa(c.clientId))
-				bbTotal.WriteString(",")
-				bbTotal.WriteString(name)
-				bbTotal.WriteString(",")
-				bbTotal.WriteString(strconv.Itoa(compressed.Len()))
-				bbTotal.WriteString(",")
-				bbTotal.Write(compressed.Bytes())
+		if ai == 0 {
+			bytesBufferPool.Put(bb)
+			continue
+		}
 
-				bytesBufferPool.Put(bb)
+		bb.WriteString(`]`)
 
-				metricsSerializedCount += 1
-			}
+		payload := bb
+		if !c.compressBatch {
+			payload = c.compressor.compressBuffer(bb)
+			bytesBufferPool.Put(bb)
+		}
 
-			if metricsSerializedCount == 0 {
-				bytesBufferPool.Put(bbTotal)
-				return nil
-			}
+		bbTotal.WriteString(strconv.Itoa(c.clientId))
+		bbTotal.WriteString(",")
+		bbTotal.WriteString(name)
+		bbTotal.WriteString(",")
+		bbTotal.WriteString(strconv.Itoa(payload.Len()))
+		bbTotal.WriteString(",")
+		bbTotal.Write(payload.Bytes())
 
-			for mName, m := range c.metricAccumsMap {
-				keepIndex := 0
-				for _, a := range m.accums {
-					if a.isReadyToSend() {
-						approx.ReleaseValueDigest(a.digest)
-						a.digest = nil
-					} else {
-						m.accums[keepIndex] = a
-						keepIndex++
-					}
-				}
-				m.accums = m.accums[:keepIndex]
+		bytesBufferPool.Put(payload)
 
-				if len(m.accums) == 0 {
-					metricsPool.Put(m)
-					delete(c.metricAccumsMap, mName)
-				}
-			}
+		metricsSerializedCount += 1
+	}
 
-			return bbTotal
-		}()
+	if metricsSerializedCount == 0 {
+		bytesBufferPool.Put(bbTotal)
+		return sendBatch{}
+	}
 
-		if serialized != nil {
-			if serialized.Len() == 0 {
-				bytesBufferPool.Put(serialized)
-				continue
+	for mName, m := range c.metricAccumsMap {
+		keepIndex := 0
+		for _, a := range m.accums {
+			if isReady(&a) {
+				approx.ReleaseValueDigest(a.digest)
+				a.digest = nil
+			} else {
+				m.accums[keepIndex] = a
+				keepIndex++
 			}
+		}
+		m.accums = m.accums[:keepIndex]
 
-			c.sendQueue <- serialized
+		if len(m.accums) == 0 {
+			metricsPool.Put(m)
+			delete(c.metricAccumsMap, mName)
 		}
 	}
+
+	if c.compressBatch {
+		return c.compressWhole(bbTotal)
+	}
+	return sendBatch{data: bbTotal, encoding: batchEncoding{frame: c.compressor.codec, content: CodecNone}}
 }
 
 func (c *Client) startSender() {
-	for bb := range c.sendQueue {
-		tries := 3
-		for tries > 0 {
-			err := c.sendToAPI(bb)
+	c.resendSpooled()
+
+	for {
+		var batch sendBatch
+		select {
+		case batch = <-c.sendQueue:
+		case <-c.stop:
+			return
+		}
+
+		if c.destinationMode == DestinationFanOut {
+			c.fanOut(batch)
+			continue
+		}
+
+		var err error
+		if batch.data != nil {
+			err = c.sendFailover(batch.data, batch.encoding)
+			bytesBufferPool.Put(batch.data)
 			if err == nil {
-				break
+				c.resendSpooled()
 			}
-			tries--
-			time.Sleep(5 * time.Second)
 		}
-		bytesBufferPool.Put(bb)
+
+		if batch.flushed != nil {
+			batch.flushed <- err
+		}
 	}
 }
 
-func (c *Client) sendToAPI(data *bytes.Buffer) error {
-	if strings.Contains(string(data.Bytes()), "ingest") {
-		log.Println("send to ", c.endpoint+"/i")
-	}
-	log.Println("send to ", c.endpoint+"/i")
-	req, err := http.NewRequest("POST", c.endpoint+"/i", bytes.NewReader(data.Bytes()))
+func (c *Client) sendToAPI(endpoint string, data *bytes.Buffer, encoding batchEncoding) error {
+	req, err := http.NewRequestWithContext(withIngestRequest(context.Background()), "POST", endpoint+"/i", bytes.NewReader(data.Bytes()))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set(HeaderFrameEncoding, encoding.frame.Encoding())
+	if encoding.content != CodecNone {
+		req.Header.Set("Content-Encoding", encoding.content.Encoding())
+	}
+	if c.signRequests {
+		if err = c.signRequest(req, data.Bytes()); err != nil {
+			return err
+		}
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
 
 	resp, err := c.httpClient.Do(req)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		if resp != nil {
-			_ = resp.Body.Close()
-		}
+	if err != nil {
 		return err
 	}
 	_ = resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("statok: unexpected response status %d", resp.StatusCode)
+	}
 	return nil
 }
 
-var encoder, _ = zstd.NewWriter(nil)
-var encoderMx sync.Mutex
+// writeJSONString writes the string as a JSON string literal, invalid UTF-8 is replaced with U+FFFD
+func writeJSONString(bb *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	bb.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				bb.WriteString(s[start:i])
+				bb.WriteString(`\ufffd`)
+				start = i + size
+			}
+			i += size
+			continue
+		}
+		if b >= 0x20 && b != '"' && b != '\\' {
+			i++
+			continue
+		}
 
-func compressBuffer(input *bytes.Buffer) *bytes.Buffer {
-	encoderMx.Lock()
-	defer encoderMx.Unlock()
+		bb.WriteString(s[start:i])
+		switch b {
+		case '"', '\\':
+			bb.WriteByte('\\')
+			bb.WriteByte(b)
+		case '\n':
+			bb.WriteString(`\n`)
+		case '\r':
+			bb.WriteString(`\r`)
+		case '\t':
+			bb.WriteString(`\t`)
+		default:
+			bb.WriteString(`\u00`)
+			bb.WriteByte(hex[b>>4])
+			bb.WriteByte(hex[b&0xf])
+		}
+		i++
+		start = i
+	}
+	bb.WriteString(s[start:])
+	bb.WriteByte('"')
+}
 
-	output := bytesBufferPool.Get()
-	output.Reset()
+type ingestRequestKey struct{}
 
-	encoder.Reset(output)
-	_, _ = encoder.Write(input.Bytes())
-	_ = encoder.Close()
+func withIngestRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ingestRequestKey{}, true)
+}
 
-	return output
+// IsIngestRequest reports whether the request is sent by a Client to the statok API,
+// so instrumented HTTP clients can exclude it instead of measuring themselves
+func IsIngestRequest(r *http.Request) bool {
+	isIngest, _ := r.Context().Value(ingestRequestKey{}).(bool)
+	return isIngest
 }
 
 func TimeToTimeIndex[T int | int64 | uint, S Step | int](ts T, step S) int {
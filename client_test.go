@@ -0,0 +1,13 @@
+package gostatok
+
+import "testing"
+
+// newTestClient creates the client with the NewClient defaults, but doesn't start its goroutines,
+// so the tests can read the events queue and the accums directly
+func newTestClient(t *testing.T, options Options) *Client {
+	t.Helper()
+	if options.APIKey == "" {
+		options.APIKey = "1_test"
+	}
+	return newClient(options)
+}
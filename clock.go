@@ -0,0 +1,35 @@
+package gostatok
+
+import "time"
+
+// Clock is the source of time of the Client: the event timestamps, the time steps readiness and
+// the flush ticker. The tests can replace it with statoktest.FakeClock to cross the step boundaries
+// without sleeping.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is the subset of time.Ticker used by the Client
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
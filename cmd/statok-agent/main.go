@@ -0,0 +1,133 @@
+// Command statok-agent aggregates the events of the local short-lived processes and uploads them with
+// the standard client, so the percentiles are aggregated across the processes. The clients point at it with
+// gostatok.Options.AgentAddress.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/agentproto"
+)
+
+const (
+	decodeErrorsMetric = "statok_agent.decode_errors"
+	// The events rejected by the agent validation, which can be stricter than the sending client one
+	rejectedMetric = "statok_agent.rejected"
+)
+
+func main() {
+	apiKey := flag.String("api-key", os.Getenv("STATOK_API_KEY"), "statok API key, $STATOK_API_KEY by default")
+	endpoint := flag.String("endpoint", os.Getenv("STATOK_ENDPOINT"), "statok endpoint, $STATOK_ENDPOINT by default")
+	unixPath := flag.String("unix", "/tmp/statok-agent.sock", "unix datagram socket path to listen on, empty to disable")
+	udpAddr := flag.String("udp", "127.0.0.1:8126", "UDP address to listen on, empty to disable")
+	flag.Parse()
+
+	if *unixPath == "" && *udpAddr == "" {
+		log.Fatal("nothing to listen on, set -unix or -udp")
+	}
+
+	client := gostatok.NewClient(gostatok.Options{APIKey: *apiKey, Endpoint: *endpoint})
+
+	var conns []net.PacketConn
+	if *unixPath != "" {
+		// Remove the stale socket of the previous run
+		_ = os.Remove(*unixPath)
+		conn, err := net.ListenPacket("unixgram", *unixPath)
+		if err != nil {
+			log.Fatalf("listen unix %s: %v", *unixPath, err)
+		}
+		// Any local user may send events
+		_ = os.Chmod(*unixPath, 0o666)
+		conns = append(conns, conn)
+	}
+	if *udpAddr != "" {
+		conn, err := net.ListenPacket("udp", *udpAddr)
+		if err != nil {
+			log.Fatalf("listen udp %s: %v", *udpAddr, err)
+		}
+		conns = append(conns, conn)
+	}
+
+	for _, conn := range conns {
+		go serve(client, conn)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	if *unixPath != "" {
+		_ = os.Remove(*unixPath)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Close(ctx); err != nil {
+		log.Printf("failed to flush the events: %v", err)
+	}
+}
+
+func serve(client *gostatok.Client, conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if n > 0 {
+			handleDatagram(client, buf[:n])
+		}
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("read %s: %v", conn.LocalAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+func handleDatagram(client *gostatok.Client, datagram []byte) {
+	events, err := agentproto.DecodeDatagram(datagram)
+	if err != nil {
+		client.Event(decodeErrorsMetric, 1)
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	// The events are forwarded one by one, so an invalid event doesn't drop the rest of the datagram
+	var rejected uint32
+	var dropErr error
+	for _, e := range events {
+		err := client.EventBatch([]gostatok.BatchEvent{{
+			MetricName: e.Name,
+			LabelKeys:  e.LabelKeys,
+			Labels:     e.Labels,
+			Counter:    e.Counter,
+			Value:      e.Value,
+			IsValue:    e.IsValue,
+			SampleRate: e.SampleRate,
+		}})
+		var validationErr *gostatok.ValidationError
+		if errors.As(err, &validationErr) {
+			rejected++
+		} else if err != nil && dropErr == nil {
+			dropErr = err
+		}
+	}
+	if rejected > 0 {
+		client.Event(rejectedMetric, rejected)
+	}
+	if dropErr != nil {
+		log.Printf("events dropped: %v", dropErr)
+	}
+}
@@ -0,0 +1,130 @@
+// Command statok-decode prints a captured ingest request body as JSON or a table, validating its framing and JSON.
+//
+//	statok-decode [-format json|table] [-content-encoding codec] [-frame-encoding codec] [-zstd-dict file] [file]
+//
+// The encodings are the values of the Content-Encoding and X-Statok-Frame-Encoding headers of the request.
+// The body is read from stdin if no file is given. The exit code is 1 if the body is malformed,
+// the metrics decoded before the malformed frame are printed anyway.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/decoder"
+)
+
+func main() {
+	format := flag.String("format", "json", "output format: json or table")
+	contentEncoding := flag.String("content-encoding", "identity", "codec of the whole body: zstd, snappy, gzip or identity")
+	frameEncoding := flag.String("frame-encoding", "zstd", "codec of the frame payloads: zstd, snappy, gzip or identity")
+	zstdDict := flag.String("zstd-dict", "", "zstd dictionary file")
+	flag.Parse()
+
+	var options decoder.Options
+	var err error
+	if options.ContentEncoding, err = gostatok.ParseCodec(*contentEncoding); err != nil {
+		log.Fatal(err)
+	}
+	if options.FrameEncoding, err = gostatok.ParseCodec(*frameEncoding); err != nil {
+		log.Fatal(err)
+	}
+	if *zstdDict != "" {
+		if options.ZstdDictionary, err = os.ReadFile(*zstdDict); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	body, err := io.ReadAll(in)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	metrics, decodeErr := decoder.DecodeWith(body, options)
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(metrics)
+	case "table":
+		err = printTable(os.Stdout, metrics)
+	default:
+		log.Fatalf("unknown format %q", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if decodeErr != nil {
+		log.Printf("malformed body: %v", decodeErr)
+		os.Exit(1)
+	}
+}
+
+func printTable(w io.Writer, metrics []decoder.Metric) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "CLIENT\tMETRIC\tSTEP\tTIME\tLABELS\tCOUNT\tRATE\tAVG\tMIN\tMAX\tPERCENTILES")
+
+	for _, m := range metrics {
+		for _, a := range m.Accums {
+			labels := make([]string, len(a.Labels))
+			for i, l := range a.Labels {
+				if a.LabelKeys != nil {
+					labels[i] = a.LabelKeys[i] + "=" + l
+				} else {
+					labels[i] = l
+				}
+			}
+
+			ts := time.Unix(int64(a.TimeIndex)*int64(a.Step), 0).UTC().Format(time.RFC3339)
+
+			rate := "-"
+			if a.SampleRate > 0 {
+				rate = strconv.FormatFloat(float64(a.SampleRate), 'g', -1, 32)
+			}
+
+			avg, minimum, maximum, percentiles := "-", "-", "-", "-"
+			if len(a.Values) >= 3 {
+				avg, minimum, maximum = formatValue(a.Values[0]), formatValue(a.Values[1]), formatValue(a.Values[2])
+				ps := make([]string, 0, len(a.Values)-3)
+				for i, v := range a.Values[3:] {
+					if a.Percentiles != nil {
+						// The non-default percentiles are named, e.g. p90=12
+						ps = append(ps, "p"+formatValue(a.Percentiles[i]*100)+"="+formatValue(v))
+					} else {
+						ps = append(ps, formatValue(v))
+					}
+				}
+				percentiles = strings.Join(ps, " ")
+			}
+
+			_, _ = fmt.Fprintf(tw, "%d\t%s\t%ds\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+				m.ClientID, m.Name, a.Step, ts, strings.Join(labels, ","), a.Counter, rate, avg, minimum, maximum, percentiles)
+		}
+	}
+	return tw.Flush()
+}
+
+func formatValue(v float32) string {
+	return strconv.FormatFloat(float64(v), 'g', -1, 32)
+}
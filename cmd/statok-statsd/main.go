@@ -0,0 +1,56 @@
+// Command statok-statsd listens for StatsD/DogStatsD datagrams and uploads them through the statok client
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statsd"
+)
+
+func main() {
+	apiKey := flag.String("api-key", os.Getenv("STATOK_API_KEY"), "statok API key, $STATOK_API_KEY by default")
+	endpoint := flag.String("endpoint", os.Getenv("STATOK_ENDPOINT"), "statok endpoint, $STATOK_ENDPOINT by default")
+	udpAddr := flag.String("udp", "127.0.0.1:8125", "UDP address to listen on, empty to disable")
+	unixAddr := flag.String("unix", "", "unix datagram socket path to listen on, empty to disable")
+	gaugeTTL := flag.Duration("gauge-ttl", time.Hour, "how long the gauges are remembered after their last update")
+	maxGauges := flag.Int("max-gauges", 10000, "limit of the remembered gauge series")
+	flag.Parse()
+
+	if *udpAddr == "" && *unixAddr == "" {
+		log.Fatal("nothing to listen on, set -udp or -unix")
+	}
+
+	client := gostatok.NewClient(gostatok.Options{APIKey: *apiKey, Endpoint: *endpoint})
+	server := statsd.NewServer(client, statsd.Options{GaugeTTL: *gaugeTTL, MaxGauges: *maxGauges})
+
+	serve := func(network, address string) {
+		if err := server.ListenAndServe(network, address); err != nil {
+			log.Fatalf("statsd %s %s: %v", network, address, err)
+		}
+	}
+	if *udpAddr != "" {
+		go serve("udp", *udpAddr)
+	}
+	if *unixAddr != "" {
+		go serve("unixgram", *unixAddr)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	_ = server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Close(ctx); err != nil {
+		log.Printf("failed to flush the events: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Command statok emits events from the shell scripts and cron jobs, flushing them before exit:
+//
+//	statok [flags] count <name> <n> [labels...]
+//	statok [flags] value <name> <v> [labels...]
+//	statok [flags] time <name> [labels...] -- <command> [args...]
+//
+// The labels are positional, or named if every one of them is key=value. The time command runs the command,
+// records its runtime as the <name>_duration_ms value and its exit code as the <name>_exit counter with
+// the extra exit_code label, then exits with the exit code of the command.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("statok: ")
+
+	apiKey := flag.String("api-key", os.Getenv("STATOK_API_KEY"), "statok API key, $STATOK_API_KEY by default")
+	endpoint := flag.String("endpoint", os.Getenv("STATOK_ENDPOINT"), "statok endpoint, $STATOK_ENDPOINT by default")
+	agentAddress := flag.String("agent", os.Getenv("STATOK_AGENT_ADDRESS"), "statok-agent address to send the events to instead, $STATOK_AGENT_ADDRESS by default")
+	timeout := flag.Duration("timeout", 30*time.Second, "max time to wait for the events to be sent")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		usage()
+		os.Exit(2)
+	}
+	if *apiKey == "" && *agentAddress == "" {
+		log.Fatal("set -api-key or $STATOK_API_KEY")
+	}
+
+	client := gostatok.NewClient(gostatok.Options{
+		APIKey:       *apiKey,
+		Endpoint:     *endpoint,
+		AgentAddress: *agentAddress,
+		// The events must not be lost, there are only a few of them anyway
+		Backpressure: gostatok.BackpressureBlock,
+	})
+
+	exitCode := 0
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "count":
+		err = count(client, args)
+	case "value":
+		err = value(client, args)
+	case "time":
+		exitCode, err = timeCommand(client, args)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+	if err != nil {
+		log.Print(err)
+		exitCode = 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err = client.Close(ctx); err != nil {
+		log.Printf("failed to send the events: %v", err)
+		if exitCode == 0 {
+			exitCode = 1
+		}
+	}
+
+	os.Exit(exitCode)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	_, _ = fmt.Fprintln(out, "Usage:")
+	_, _ = fmt.Fprintln(out, "  statok [flags] count <name> <n> [labels...]")
+	_, _ = fmt.Fprintln(out, "  statok [flags] value <name> <v> [labels...]")
+	_, _ = fmt.Fprintln(out, "  statok [flags] time <name> [labels...] -- <command> [args...]")
+	_, _ = fmt.Fprintln(out, "Labels are positional, or named if all of them are key=value.")
+	_, _ = fmt.Fprintln(out, "Flags:")
+	flag.PrintDefaults()
+}
+
+func count(client *gostatok.Client, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: count <name> <n> [labels...]")
+	}
+	n, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid count %q", args[1])
+	}
+	return emitCounter(client, args[0], uint32(n), args[2:])
+}
+
+func value(client *gostatok.Client, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: value <name> <v> [labels...]")
+	}
+	v, err := strconv.ParseFloat(args[1], 32)
+	if err != nil {
+		return fmt.Errorf("invalid value %q", args[1])
+	}
+	return emitValue(client, args[0], float32(v), args[2:])
+}
+
+// timeCommand runs the command after "--" and returns its exit code
+func timeCommand(client *gostatok.Client, args []string) (int, error) {
+	sep := -1
+	for i, arg := range args {
+		if arg == "--" {
+			sep = i
+			break
+		}
+	}
+	if sep < 1 || sep == len(args)-1 {
+		return 0, errors.New("usage: time <name> [labels...] -- <command> [args...]")
+	}
+	name, labels, command := args[0], args[1:sep], args[sep+1:]
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// The signals are meant for the command, which receives them as a member of the same process group
+	signal.Ignore(os.Interrupt)
+
+	start := time.Now()
+	err := cmd.Run()
+	duration := time.Since(start)
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case err != nil:
+		// Same as the shells do for a command that can't be run
+		log.Print(err)
+		exitCode = 127
+	}
+
+	if err = emitValue(client, name+"_duration_ms", float32(duration.Seconds()*1000), labels); err != nil {
+		return exitCode, err
+	}
+
+	exitLabels := append(labels[:len(labels):len(labels)], strconv.Itoa(exitCode))
+	if isNamed(labels) {
+		exitLabels[len(labels)] = "exit_code=" + exitLabels[len(labels)]
+	}
+	return exitCode, emitCounter(client, name+"_exit", 1, exitLabels)
+}
+
+func emitCounter(client *gostatok.Client, name string, n uint32, labels []string) error {
+	if isNamed(labels) {
+		return client.EventLabelsWithError(name, n, namedLabels(labels))
+	}
+	return client.EventWithError(name, n, labels...)
+}
+
+func emitValue(client *gostatok.Client, name string, v float32, labels []string) error {
+	if isNamed(labels) {
+		return client.EventValueLabelsWithError(name, v, namedLabels(labels))
+	}
+	return client.EventValueWithError(name, v, labels...)
+}
+
+func isNamed(labels []string) bool {
+	if len(labels) == 0 {
+		return false
+	}
+	for _, l := range labels {
+		if !strings.Contains(l, "=") {
+			return false
+		}
+	}
+	return true
+}
+
+func namedLabels(labels []string) gostatok.Labels {
+	named := make(gostatok.Labels, len(labels))
+	for i, l := range labels {
+		key, value, _ := strings.Cut(l, "=")
+		named[i] = gostatok.Label{Key: key, Value: value}
+	}
+	return named
+}
@@ -1 +1,185 @@
 package gostatok
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is the compression of the payloads, see Options.Codec
+type Codec uint8
+
+const (
+	// CodecZstd compresses with zstd, optionally with a trained dictionary, see Options.ZstdDictionary
+	CodecZstd Codec = iota
+	// CodecSnappy compresses with the snappy block format, faster than zstd but with worse ratios
+	CodecSnappy
+	// CodecGzip compresses with gzip
+	CodecGzip
+	// CodecNone sends the payloads as they are
+	CodecNone
+)
+
+// HeaderFrameEncoding is the codec of the payloads of the frames, zstd if it's missing.
+// The codec of the whole body is sent in Content-Encoding, see Options.CompressBatch.
+// The backends that don't read it decode every frame as zstd, so any Codec other than CodecZstd, with or without
+// CompressBatch, requires a backend that does.
+const HeaderFrameEncoding = "X-Statok-Frame-Encoding"
+
+// Encoding returns the name of the codec for the Content-Encoding and HeaderFrameEncoding headers
+func (c Codec) Encoding() string {
+	switch c {
+	case CodecZstd:
+		return "zstd"
+	case CodecSnappy:
+		return "snappy"
+	case CodecGzip:
+		return "gzip"
+	case CodecNone:
+		return "identity"
+	default:
+		return "unknown"
+	}
+}
+
+func (c Codec) String() string {
+	return c.Encoding()
+}
+
+// ParseCodec parses the Codec.Encoding names, "none" and "" (a missing header) are accepted for CodecNone
+func ParseCodec(s string) (Codec, error) {
+	switch s {
+	case "zstd":
+		return CodecZstd, nil
+	case "snappy":
+		return CodecSnappy, nil
+	case "gzip":
+		return CodecGzip, nil
+	case "identity", "none", "":
+		return CodecNone, nil
+	default:
+		return 0, fmt.Errorf("unknown codec %q", s)
+	}
+}
+
+// compressor compresses with the codec of the client, the callers must hold metricAccumsMx
+type compressor struct {
+	codec Codec
+
+	zstd      *zstd.Encoder
+	gzip      *gzip.Writer
+	gzipLevel int
+}
+
+// newCompressor makes the compressor, level is the zstd or gzip level, 0 for the default one
+func newCompressor(codec Codec, level int, zstdDictionary []byte) (*compressor, error) {
+	cp := &compressor{codec: codec}
+
+	switch codec {
+	case CodecZstd:
+		options := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level != 0 {
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		if zstdDictionary != nil {
+			options = append(options, zstd.WithEncoderDict(zstdDictionary))
+		}
+		encoder, err := zstd.NewWriter(nil, options...)
+		if err != nil {
+			return nil, err
+		}
+		cp.zstd = encoder
+	case CodecGzip:
+		cp.gzipLevel = gzip.DefaultCompression
+		if level != 0 {
+			cp.gzipLevel = level
+		}
+		writer, err := gzip.NewWriterLevel(nil, cp.gzipLevel)
+		if err != nil {
+			return nil, err
+		}
+		cp.gzip = writer
+	case CodecSnappy, CodecNone:
+	default:
+		return nil, fmt.Errorf("unknown codec %d", codec)
+	}
+
+	return cp, nil
+}
+
+// compressBuffer returns the compressed input in a buffer of bytesBufferPool
+func (cp *compressor) compressBuffer(input *bytes.Buffer) *bytes.Buffer {
+	output := bytesBufferPool.Get()
+	output.Reset()
+
+	switch cp.codec {
+	case CodecZstd:
+		output.Write(cp.zstd.EncodeAll(input.Bytes(), output.AvailableBuffer()))
+	case CodecSnappy:
+		output.Write(snappy.Encode(nil, input.Bytes()))
+	case CodecGzip:
+		cp.gzip.Reset(output)
+		_, _ = cp.gzip.Write(input.Bytes())
+		_ = cp.gzip.Close()
+	default:
+		output.Write(input.Bytes())
+	}
+
+	return output
+}
+
+// batchEncoding is the compression of a serialized batch, advertised in the HeaderFrameEncoding and
+// Content-Encoding headers of its request
+type batchEncoding struct {
+	// The codec of the payloads of the frames
+	frame Codec
+	// The codec of the whole body
+	content Codec
+}
+
+const (
+	// The smaller batches aren't worth compressing with Options.AdaptiveCompression
+	adaptiveCompressionMinBytes = 512
+	// The compressed batch is sent only if it's at most this part of the uncompressed one
+	adaptiveCompressionMaxRatio = 0.9
+	// The number of the batches sent uncompressed after a poor ratio, before compressing again
+	adaptiveCompressionSkipBatches = 10
+)
+
+// adaptiveCompression is the state of Options.AdaptiveCompression
+type adaptiveCompression struct {
+	// The number of the next batches to send uncompressed
+	skip int
+}
+
+// compressWhole compresses the serialized frames as a whole, unless Options.AdaptiveCompression finds it isn't
+// worth it. It takes over the buffer, metricAccumsMx must be held.
+func (c *Client) compressWhole(bb *bytes.Buffer) sendBatch {
+	uncompressed := sendBatch{data: bb, encoding: batchEncoding{frame: CodecNone, content: CodecNone}}
+	if c.compressor.codec == CodecNone {
+		return uncompressed
+	}
+
+	a := c.adaptive
+	if a != nil {
+		if bb.Len() < adaptiveCompressionMinBytes {
+			return uncompressed
+		}
+		if a.skip > 0 {
+			a.skip--
+			return uncompressed
+		}
+	}
+
+	compressed := c.compressor.compressBuffer(bb)
+	if a != nil && float64(compressed.Len()) > float64(bb.Len())*adaptiveCompressionMaxRatio {
+		a.skip = adaptiveCompressionSkipBatches
+		bytesBufferPool.Put(compressed)
+		return uncompressed
+	}
+	bytesBufferPool.Put(bb)
+	return sendBatch{data: compressed, encoding: batchEncoding{frame: CodecNone, content: c.compressor.codec}}
+}
@@ -0,0 +1,155 @@
+package gostatok_test
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/dict"
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+func TestCodecs(t *testing.T) {
+	for _, codec := range []gostatok.Codec{gostatok.CodecZstd, gostatok.CodecSnappy, gostatok.CodecGzip, gostatok.CodecNone} {
+		for _, compressBatch := range []bool{false, true} {
+			t.Run(codec.String()+"/batch="+strconv.FormatBool(compressBatch), func(t *testing.T) {
+				server := statoktest.NewIngestServer("1_test")
+				defer server.Close()
+
+				client := gostatok.NewClient(gostatok.Options{
+					APIKey:           "1_test",
+					Endpoint:         server.URL(),
+					Codec:            codec,
+					CompressionLevel: compressionLevel(codec),
+					CompressBatch:    compressBatch,
+				})
+				defer client.Close(context.Background())
+
+				client.Event("jobs", 2, "cron")
+				client.EventValue("duration", 1.5)
+				if err := client.Flush(context.Background()); err != nil {
+					t.Fatalf("%v, server errors: %v", err, server.Errors())
+				}
+
+				assertCounter(t, server, "jobs", 2)
+				assertSteps(t, server, "duration", 10, 60, 600, 3600)
+			})
+		}
+	}
+}
+
+func compressionLevel(codec gostatok.Codec) int {
+	switch codec {
+	case gostatok.CodecZstd:
+		return 19
+	case gostatok.CodecGzip:
+		return 9
+	default:
+		return 0
+	}
+}
+
+func TestZstdDictionary(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 100; i++ {
+		samples = append(samples, []byte(`[{"t":`+strconv.Itoa(170000000+i)+`,"s":10,"k":["route","status"],"l":["/api/orders","2xx"],"c":`+strconv.Itoa(i)+`}]`))
+	}
+	dictionary, err := dict.BuildZstdDict(samples, dict.Options{MaxDictSize: 1024, HashBytes: 6, ZstdDictID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := statoktest.NewIngestServer("1_test")
+	defer server.Close()
+	server.SetZstdDictionary(dictionary)
+
+	client := gostatok.NewClient(gostatok.Options{APIKey: "1_test", Endpoint: server.URL(), ZstdDictionary: dictionary})
+	defer client.Close(context.Background())
+
+	client.EventLabels("requests", 3, gostatok.L("route", "/api/orders", "status", "2xx"))
+	if err = client.Flush(context.Background()); err != nil {
+		t.Fatalf("%v, server errors: %v", err, server.Errors())
+	}
+	assertCounter(t, server, "requests", 3)
+
+	// The payload can't be decoded without the dictionary
+	plain := statoktest.NewIngestServer("1_test")
+	defer plain.Close()
+
+	client = gostatok.NewClient(gostatok.Options{
+		APIKey:         "1_test",
+		Endpoint:       plain.URL(),
+		ZstdDictionary: dictionary,
+		RetryDelay:     time.Millisecond,
+		LogLevel:       gostatok.LogLevelOff,
+	})
+	defer client.Close(context.Background())
+
+	client.EventLabels("requests", 3, gostatok.L("route", "/api/orders", "status", "2xx"))
+	if err = client.Flush(context.Background()); err == nil || len(plain.Errors()) == 0 {
+		t.Fatal("payload compressed with the dictionary was decoded without it")
+	}
+}
+
+func TestCodecConfigErrors(t *testing.T) {
+	t.Setenv(gostatok.EnvAPIKey, "1_test")
+	t.Setenv(gostatok.EnvCodec, "gzip")
+	t.Setenv(gostatok.EnvCompressionLevel, "42")
+
+	if _, err := gostatok.OptionsFromEnv(); err == nil || !strings.Contains(err.Error(), "compression_level") {
+		t.Fatalf("expected an invalid compression level error, got %v", err)
+	}
+}
+
+// encodingRecorder records the Content-Encoding of the requests
+type encodingRecorder struct {
+	mx        sync.Mutex
+	encodings []string
+}
+
+func (r *encodingRecorder) Do(req *http.Request) (*http.Response, error) {
+	r.mx.Lock()
+	r.encodings = append(r.encodings, req.Header.Get("Content-Encoding"))
+	r.mx.Unlock()
+	return http.DefaultClient.Do(req)
+}
+
+func TestAdaptiveCompressionDecoded(t *testing.T) {
+	server := statoktest.NewIngestServer("1_test")
+	defer server.Close()
+
+	recorder := &encodingRecorder{}
+	client := gostatok.NewClient(gostatok.Options{
+		APIKey:              "1_test",
+		Endpoint:            server.URL(),
+		HTTPClient:          recorder,
+		Codec:               gostatok.CodecGzip,
+		AdaptiveCompression: true,
+	})
+	defer client.Close(context.Background())
+
+	// A small batch is sent uncompressed, a large one compressed, both are decoded by the backend
+	client.Event("jobs", 2, "cron")
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("%v, server errors: %v", err, server.Errors())
+	}
+	for i := range 100 {
+		client.Event("jobs.route"+strconv.Itoa(i), 1, "/api/orders", "2xx")
+	}
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("%v, server errors: %v", err, server.Errors())
+	}
+
+	if !slices.Equal(recorder.encodings, []string{"", "gzip"}) {
+		t.Fatalf("unexpected encodings %q", recorder.encodings)
+	}
+	if metrics := server.Metrics(); len(metrics) != 101 {
+		t.Fatalf("got %d metrics", len(metrics))
+	}
+}
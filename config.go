@@ -0,0 +1,408 @@
+package gostatok
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The environment variables read by OptionsFromEnv
+const (
+	EnvConfig              = "STATOK_CONFIG"
+	EnvAPIKey              = "STATOK_API_KEY"
+	EnvEndpoint            = "STATOK_ENDPOINT"
+	EnvDestinations        = "STATOK_DESTINATIONS"
+	EnvDestinationMode     = "STATOK_DESTINATION_MODE"
+	EnvAgentAddress        = "STATOK_AGENT_ADDRESS"
+	EnvSteps               = "STATOK_STEPS"
+	EnvPercentiles         = "STATOK_PERCENTILES"
+	EnvSampleRate          = "STATOK_SAMPLE_RATE"
+	EnvMetricSampleRates   = "STATOK_METRIC_SAMPLE_RATES"
+	EnvSpoolDir            = "STATOK_SPOOL_DIR"
+	EnvLogLevel            = "STATOK_LOG_LEVEL"
+	EnvSignRequests        = "STATOK_SIGN_REQUESTS"
+	EnvCodec               = "STATOK_CODEC"
+	EnvCompressionLevel    = "STATOK_COMPRESSION_LEVEL"
+	EnvCompressBatch       = "STATOK_COMPRESS_BATCH"
+	EnvAdaptiveCompression = "STATOK_ADAPTIVE_COMPRESSION"
+)
+
+// ConfigError is a configuration setting that couldn't be applied. Source is the config file path or "env".
+type ConfigError struct {
+	Source string
+	Key    string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("statok config %s: %s: %v", e.Source, e.Key, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// fileConfig is the config file representation of Options, the keys match the environment variables
+// without the STATOK_ prefix in lower case, e.g.
+//
+//	api_key: 1_secret
+//	steps: [10s, 1m]
+//	percentiles: [50, 90, 99.9]
+//	sample_rate: 0.5
+//	metric_sample_rates:
+//	  http_requests: 0.1
+//	spool_dir: /var/spool/statok
+//	log_level: debug
+type fileConfig struct {
+	APIKey              string             `json:"api_key" yaml:"api_key"`
+	Endpoint            string             `json:"endpoint" yaml:"endpoint"`
+	Destinations        []string           `json:"destinations" yaml:"destinations"`
+	DestinationMode     string             `json:"destination_mode" yaml:"destination_mode"`
+	AgentAddress        string             `json:"agent_address" yaml:"agent_address"`
+	Steps               []string           `json:"steps" yaml:"steps"`
+	Percentiles         []float64          `json:"percentiles" yaml:"percentiles"`
+	SampleRate          *float64           `json:"sample_rate" yaml:"sample_rate"`
+	MetricSampleRates   map[string]float64 `json:"metric_sample_rates" yaml:"metric_sample_rates"`
+	SpoolDir            string             `json:"spool_dir" yaml:"spool_dir"`
+	LogLevel            string             `json:"log_level" yaml:"log_level"`
+	SignRequests        bool               `json:"sign_requests" yaml:"sign_requests"`
+	Codec               string             `json:"codec" yaml:"codec"`
+	CompressionLevel    int                `json:"compression_level" yaml:"compression_level"`
+	CompressBatch       bool               `json:"compress_batch" yaml:"compress_batch"`
+	AdaptiveCompression bool               `json:"adaptive_compression" yaml:"adaptive_compression"`
+}
+
+// LoadOptionsFile reads the Options from the JSON (.json) or YAML (.yaml, .yml) config file.
+// All the invalid settings are reported as *ConfigError joined together.
+func LoadOptionsFile(path string) (Options, error) {
+	var options Options
+	err := loadOptionsFile(&options, path)
+	if err != nil {
+		return options, err
+	}
+	return options, validateOptions(&options, path)
+}
+
+func loadOptionsFile(options *Options, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return &ConfigError{path, "file", err}
+	}
+
+	var config fileConfig
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&config)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&config)
+	default:
+		err = fmt.Errorf("unknown format %q, expected .json, .yaml or .yml", ext)
+	}
+	if err != nil {
+		return &ConfigError{path, "file", err}
+	}
+
+	var errs []error
+	addErr := func(key string, err error) {
+		errs = append(errs, &ConfigError{path, key, err})
+	}
+
+	options.APIKey = config.APIKey
+	options.Endpoint = config.Endpoint
+	options.Destinations = config.Destinations
+	if config.DestinationMode != "" {
+		if options.DestinationMode, err = parseDestinationMode(config.DestinationMode); err != nil {
+			addErr("destination_mode", err)
+		}
+	}
+	options.AgentAddress = config.AgentAddress
+	for _, s := range config.Steps {
+		step, err := parseStep(s)
+		if err != nil {
+			addErr("steps", err)
+			continue
+		}
+		options.Steps = append(options.Steps, step)
+	}
+	for _, v := range config.Percentiles {
+		p, err := percentileFraction(v)
+		if err != nil {
+			addErr("percentiles", err)
+			continue
+		}
+		options.Percentiles = append(options.Percentiles, p)
+	}
+	if config.SampleRate != nil {
+		options.SampleRate = *config.SampleRate
+	}
+	options.MetricSampleRates = config.MetricSampleRates
+	options.SpoolDir = config.SpoolDir
+	if config.LogLevel != "" {
+		if options.LogLevel, err = ParseLogLevel(config.LogLevel); err != nil {
+			addErr("log_level", err)
+		}
+	}
+	options.SignRequests = config.SignRequests
+	if config.Codec != "" {
+		if options.Codec, err = ParseCodec(config.Codec); err != nil {
+			addErr("codec", err)
+		}
+	}
+	options.CompressionLevel = config.CompressionLevel
+	options.CompressBatch = config.CompressBatch
+	options.AdaptiveCompression = config.AdaptiveCompression
+
+	return errors.Join(errs...)
+}
+
+// OptionsFromEnv reads the Options from the config file at $STATOK_CONFIG if it's set, then overrides them
+// with the rest of the STATOK_* environment variables that are set:
+//
+//	STATOK_API_KEY               API key
+//	STATOK_ENDPOINT              API endpoint
+//	STATOK_DESTINATIONS          comma separated API endpoints, see Options.Destinations
+//	STATOK_DESTINATION_MODE      failover or fan_out
+//	STATOK_AGENT_ADDRESS         local agent address, see Options.AgentAddress
+//	STATOK_STEPS                 comma separated steps in seconds or as durations, e.g. 10,60 or 10s,1m
+//	STATOK_PERCENTILES           comma separated percentiles or fractions, e.g. p50,p90,p99.9 or 0.5,0.9
+//	STATOK_SAMPLE_RATE           global sample rate
+//	STATOK_METRIC_SAMPLE_RATES   comma separated name=rate pairs, e.g. http_requests=0.1,sql_queries=0.5
+//	STATOK_SPOOL_DIR             directory of the undelivered batches, see Options.SpoolDir
+//	STATOK_LOG_LEVEL             debug, warn or off
+//	STATOK_SIGN_REQUESTS         true to sign the requests, see Options.SignRequests
+//	STATOK_CODEC                 zstd, snappy, gzip or none
+//	STATOK_COMPRESSION_LEVEL     zstd or gzip compression level
+//	STATOK_COMPRESS_BATCH        true to compress the whole batch, see Options.CompressBatch
+//	STATOK_ADAPTIVE_COMPRESSION  true to compress the whole batch when it pays off, see Options.AdaptiveCompression
+//
+// All the invalid settings are reported as *ConfigError joined together.
+func OptionsFromEnv() (Options, error) {
+	var options Options
+	if path := os.Getenv(EnvConfig); path != "" {
+		if err := loadOptionsFile(&options, path); err != nil {
+			return options, err
+		}
+	}
+
+	var errs []error
+	addErr := func(key string, err error) {
+		errs = append(errs, &ConfigError{"env", key, err})
+	}
+
+	if v, ok := os.LookupEnv(EnvAPIKey); ok {
+		options.APIKey = v
+	}
+	if v, ok := os.LookupEnv(EnvEndpoint); ok {
+		options.Endpoint = v
+	}
+	if v, ok := os.LookupEnv(EnvDestinations); ok {
+		options.Destinations = splitList(v)
+	}
+	if v, ok := os.LookupEnv(EnvDestinationMode); ok {
+		mode, err := parseDestinationMode(v)
+		if err != nil {
+			addErr(EnvDestinationMode, err)
+		}
+		options.DestinationMode = mode
+	}
+	if v, ok := os.LookupEnv(EnvAgentAddress); ok {
+		options.AgentAddress = v
+	}
+	if v, ok := os.LookupEnv(EnvSteps); ok {
+		options.Steps = nil
+		for _, s := range splitList(v) {
+			step, err := parseStep(s)
+			if err != nil {
+				addErr(EnvSteps, err)
+				continue
+			}
+			options.Steps = append(options.Steps, step)
+		}
+	}
+	if v, ok := os.LookupEnv(EnvPercentiles); ok {
+		options.Percentiles = nil
+		for _, s := range splitList(v) {
+			f, err := strconv.ParseFloat(strings.TrimPrefix(s, "p"), 64)
+			if err != nil {
+				addErr(EnvPercentiles, fmt.Errorf("invalid percentile %q", s))
+				continue
+			}
+			p, err := percentileFraction(f)
+			if err != nil {
+				addErr(EnvPercentiles, err)
+				continue
+			}
+			options.Percentiles = append(options.Percentiles, p)
+		}
+	}
+	if v, ok := os.LookupEnv(EnvSampleRate); ok {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			addErr(EnvSampleRate, fmt.Errorf("invalid rate %q", v))
+		}
+		options.SampleRate = rate
+	}
+	if v, ok := os.LookupEnv(EnvMetricSampleRates); ok {
+		options.MetricSampleRates = make(map[string]float64)
+		for _, pair := range splitList(v) {
+			name, s, _ := strings.Cut(pair, "=")
+			rate, err := strconv.ParseFloat(s, 64)
+			if name == "" || err != nil {
+				addErr(EnvMetricSampleRates, fmt.Errorf("invalid name=rate pair %q", pair))
+				continue
+			}
+			options.MetricSampleRates[name] = rate
+		}
+	}
+	if v, ok := os.LookupEnv(EnvSpoolDir); ok {
+		options.SpoolDir = v
+	}
+	if v, ok := os.LookupEnv(EnvLogLevel); ok {
+		level, err := ParseLogLevel(v)
+		if err != nil {
+			addErr(EnvLogLevel, err)
+		}
+		options.LogLevel = level
+	}
+
+	if v, ok := os.LookupEnv(EnvSignRequests); ok {
+		sign, err := strconv.ParseBool(v)
+		if err != nil {
+			addErr(EnvSignRequests, fmt.Errorf("invalid bool %q", v))
+		}
+		options.SignRequests = sign
+	}
+	if v, ok := os.LookupEnv(EnvCodec); ok {
+		// ParseCodec takes "" for the missing Content-Encoding, here it would silently turn the compression off
+		codec, err := ParseCodec(v)
+		if v == "" {
+			err = errors.New("empty codec")
+		}
+		if err != nil {
+			addErr(EnvCodec, err)
+		}
+		options.Codec = codec
+	}
+	if v, ok := os.LookupEnv(EnvCompressionLevel); ok {
+		level, err := strconv.Atoi(v)
+		if err != nil {
+			addErr(EnvCompressionLevel, fmt.Errorf("invalid level %q", v))
+		}
+		options.CompressionLevel = level
+	}
+	if v, ok := os.LookupEnv(EnvCompressBatch); ok {
+		compressBatch, err := strconv.ParseBool(v)
+		if err != nil {
+			addErr(EnvCompressBatch, fmt.Errorf("invalid bool %q", v))
+		}
+		options.CompressBatch = compressBatch
+	}
+	if v, ok := os.LookupEnv(EnvAdaptiveCompression); ok {
+		adaptive, err := strconv.ParseBool(v)
+		if err != nil {
+			addErr(EnvAdaptiveCompression, fmt.Errorf("invalid bool %q", v))
+		}
+		options.AdaptiveCompression = adaptive
+	}
+
+	if len(errs) > 0 {
+		return options, errors.Join(errs...)
+	}
+	return options, validateOptions(&options, "env")
+}
+
+// InitFromEnv initializes the package level client with OptionsFromEnv
+func InitFromEnv() error {
+	options, err := OptionsFromEnv()
+	if err != nil {
+		return err
+	}
+	Init(options)
+	return nil
+}
+
+// validateOptions checks the settings NewClient would otherwise fail on
+func validateOptions(options *Options, source string) error {
+	var errs []error
+	if options.AgentAddress == "" {
+		id, secret, ok := strings.Cut(options.APIKey, "_")
+		if _, err := strconv.Atoi(id); !ok || err != nil || secret == "" || strings.Contains(secret, "_") {
+			errs = append(errs, &ConfigError{source, "api_key", errors.New("expected <client id>_<secret>")})
+		}
+	}
+	if options.SampleRate < 0 || options.SampleRate > 1 {
+		errs = append(errs, &ConfigError{source, "sample_rate", fmt.Errorf("%v is out of [0, 1]", options.SampleRate)})
+	}
+	for name, rate := range options.MetricSampleRates {
+		if rate < 0 || rate > 1 {
+			errs = append(errs, &ConfigError{source, "metric_sample_rates", fmt.Errorf("%s: %v is out of [0, 1]", name, rate)})
+		}
+	}
+	if options.Codec > CodecNone {
+		errs = append(errs, &ConfigError{source, "codec", fmt.Errorf("unknown codec %d", options.Codec)})
+	} else if _, err := newCompressor(options.Codec, options.CompressionLevel, options.ZstdDictionary); err != nil {
+		errs = append(errs, &ConfigError{source, "compression_level", err})
+	}
+	return errors.Join(errs...)
+}
+
+func parseDestinationMode(s string) (DestinationMode, error) {
+	for _, mode := range [...]DestinationMode{DestinationFailover, DestinationFanOut} {
+		if s == mode.String() {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown destination mode %q, expected failover or fan_out", s)
+}
+
+// parseStep parses the step in seconds, e.g. "60", or as a duration, e.g. "1m"
+func parseStep(s string) (Step, error) {
+	seconds, err := strconv.Atoi(s)
+	if err != nil {
+		d, durationErr := time.ParseDuration(s)
+		if durationErr != nil {
+			return 0, fmt.Errorf("invalid step %q", s)
+		}
+		seconds = int(d / time.Second)
+	}
+	if !slices.Contains(Steps[:], Step(seconds)) {
+		return 0, fmt.Errorf("unsupported step %q, expected one of %v", s, Steps)
+	}
+	return Step(seconds), nil
+}
+
+// percentileFraction converts the percentile to the fraction of Options.Percentiles, the values from 1 are taken
+// as percentages, e.g. 99.9 is 0.999
+func percentileFraction(p float64) (float32, error) {
+	fraction := p
+	if p >= 1 {
+		fraction = p / 100
+	}
+	if !(fraction > 0 && fraction < 1) {
+		return 0, fmt.Errorf("percentile %v is out of (0, 100)", p)
+	}
+	return float32(fraction), nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,135 @@
+package gostatok
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "statok.yaml")
+	config := `
+api_key: 1_file
+endpoint: https://file.example
+steps: [10s, 1m, 600]
+percentiles: [50, 99.9]
+sample_rate: 0.5
+metric_sample_rates:
+  http_requests: 0.1
+spool_dir: /var/spool/statok
+log_level: debug
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(EnvConfig, path)
+	t.Setenv(EnvAPIKey, "2_env")
+	t.Setenv(EnvSampleRate, "0.25")
+	t.Setenv(EnvSteps, "10,3600")
+	t.Setenv(EnvPercentiles, "p90,0.99")
+	t.Setenv(EnvAdaptiveCompression, "true")
+
+	options, err := OptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The environment overrides the file
+	if options.APIKey != "2_env" || options.SampleRate != 0.25 || !slices.Equal(options.Steps, []Step{Step10s, Step3600s}) ||
+		!slices.Equal(options.Percentiles, []float32{0.9, 0.99}) || !options.AdaptiveCompression {
+		t.Errorf("environment didn't override the file: %+v", options)
+	}
+	if options.Endpoint != "https://file.example" || options.MetricSampleRates["http_requests"] != 0.1 ||
+		options.SpoolDir != "/var/spool/statok" || options.LogLevel != LogLevelDebug {
+		t.Errorf("file settings weren't applied: %+v", options)
+	}
+
+	os.Unsetenv(EnvSteps)
+	os.Unsetenv(EnvPercentiles)
+	if options, err = OptionsFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(options.Steps, []Step{Step10s, Step60s, Step600s}) || !slices.Equal(options.Percentiles, []float32{0.5, 0.999}) {
+		t.Errorf("unexpected file steps and percentiles: %+v", options)
+	}
+}
+
+func TestOptionsFromEnvErrors(t *testing.T) {
+	t.Setenv(EnvAPIKey, "invalid")
+	t.Setenv(EnvSteps, "10,15")
+	t.Setenv(EnvPercentiles, "50,100")
+	t.Setenv(EnvLogLevel, "loud")
+	t.Setenv(EnvCodec, "lz4")
+
+	_, err := OptionsFromEnv()
+	for _, key := range []string{EnvSteps, EnvPercentiles, EnvLogLevel, EnvCodec} {
+		if !hasConfigError(err, key) {
+			t.Errorf("expected an error for %s, got %v", key, err)
+		}
+	}
+
+	// The empty codec would turn the compression off
+	t.Setenv(EnvCodec, "")
+	if _, err = OptionsFromEnv(); !hasConfigError(err, EnvCodec) {
+		t.Errorf("expected an empty codec error, got %v", err)
+	}
+
+	os.Unsetenv(EnvSteps)
+	os.Unsetenv(EnvPercentiles)
+	os.Unsetenv(EnvLogLevel)
+	os.Unsetenv(EnvCodec)
+	if _, err = OptionsFromEnv(); !hasConfigError(err, "api_key") {
+		t.Errorf("expected an invalid api key error, got %v", err)
+	}
+}
+
+func TestLoadOptionsFileJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "statok.json")
+	if err := os.WriteFile(path, []byte(`{"agent_address": "udp://127.0.0.1:8126", "sample_rate": 2, "unknown": 1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOptionsFile(path); !hasConfigError(err, "file") {
+		t.Errorf("expected an unknown key error, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"agent_address": "udp://127.0.0.1:8126", "sample_rate": 2}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	options, err := LoadOptionsFile(path)
+	if !hasConfigError(err, "sample_rate") {
+		t.Errorf("expected an invalid sample rate error, got %v", err)
+	}
+	if options.AgentAddress != "udp://127.0.0.1:8126" {
+		t.Errorf("unexpected options: %+v", options)
+	}
+}
+
+func TestValidateOptionsCodec(t *testing.T) {
+	options := Options{APIKey: "1_secret", Codec: CodecNone + 1}
+	if err := validateOptions(&options, "test"); !hasConfigError(err, "codec") || hasConfigError(err, "compression_level") {
+		t.Errorf("expected a codec error, got %v", err)
+	}
+
+	options = Options{APIKey: "1_secret", Codec: CodecGzip, CompressionLevel: 42}
+	if err := validateOptions(&options, "test"); !hasConfigError(err, "compression_level") {
+		t.Errorf("expected a compression level error, got %v", err)
+	}
+}
+
+func hasConfigError(err error, key string) bool {
+	var joined interface{ Unwrap() []error }
+	errs := []error{err}
+	if errors.As(err, &joined) {
+		errs = joined.Unwrap()
+	}
+	for _, err := range errs {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) && configErr.Key == key {
+			return true
+		}
+	}
+	return false
+}
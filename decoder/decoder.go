@@ -0,0 +1,225 @@
+// Package decoder parses the ingest payloads produced by the Client back into the metrics
+package decoder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/approx"
+)
+
+// Accum is a decoded accum
+type Accum struct {
+	TimeIndex int      `json:"t"`
+	Step      int      `json:"s"`
+	LabelKeys []string `json:"k,omitempty"`
+	Labels    []string `json:"l,omitempty"`
+	Counter   uint32   `json:"c"`
+	// SampleRate is 0 if the accum was not sampled
+	SampleRate float32 `json:"r,omitempty"`
+	// Percentiles are the gostatok.Options.Percentiles of the Values, nil for the default approx.Percentiles
+	Percentiles []float32 `json:"p,omitempty"`
+	// Values are avg, min, max and the Percentiles, nil for the counters
+	Values []float32 `json:"v,omitempty"`
+}
+
+// PercentilesOrDefault returns the Percentiles, or approx.Percentiles if they weren't sent
+func (a Accum) PercentilesOrDefault() []float32 {
+	if a.Percentiles == nil {
+		return approx.Percentiles[:]
+	}
+	return a.Percentiles
+}
+
+// Metric is a decoded frame of the payload
+type Metric struct {
+	ClientID int     `json:"client_id"`
+	Name     string  `json:"name"`
+	Accums   []Accum `json:"accums"`
+}
+
+// FrameError tells which frame of the payload is malformed and where it starts
+type FrameError struct {
+	Frame  int
+	Offset int
+	Err    error
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("frame #%d at offset %d: %v", e.Frame, e.Offset, e.Err)
+}
+
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
+
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+// Options are the encodings of the payload, see OptionsFromHeader
+type Options struct {
+	// ContentEncoding is the codec of the whole body, CodecNone unless gostatok.Options.CompressBatch is set
+	ContentEncoding gostatok.Codec
+	// FrameEncoding is the codec of the payloads of the frames, CodecNone if gostatok.Options.CompressBatch is set
+	FrameEncoding gostatok.Codec
+	// ZstdDictionary is the dictionary of gostatok.Options.ZstdDictionary
+	ZstdDictionary []byte
+}
+
+// OptionsFromHeader reads the encodings from the Content-Encoding and gostatok.HeaderFrameEncoding request headers
+func OptionsFromHeader(header http.Header) (Options, error) {
+	options := Options{ContentEncoding: gostatok.CodecNone, FrameEncoding: gostatok.CodecZstd}
+
+	var err error
+	if options.ContentEncoding, err = gostatok.ParseCodec(header.Get("Content-Encoding")); err != nil {
+		return options, fmt.Errorf("Content-Encoding: %w", err)
+	}
+	if frameEncoding := header.Get(gostatok.HeaderFrameEncoding); frameEncoding != "" {
+		if options.FrameEncoding, err = gostatok.ParseCodec(frameEncoding); err != nil {
+			return options, fmt.Errorf("%s: %w", gostatok.HeaderFrameEncoding, err)
+		}
+	}
+	return options, nil
+}
+
+// Decode parses the frames of the payload: <client id>,<metric name>,<payload length>,<zstd payload>,
+// where the payload is a JSON array of the accums. The metrics decoded before a malformed frame are
+// returned with the *FrameError.
+func Decode(body []byte) ([]Metric, error) {
+	return DecodeWith(body, Options{ContentEncoding: gostatok.CodecNone, FrameEncoding: gostatok.CodecZstd})
+}
+
+// DecodeWith is Decode of the payload with the encodings of the options
+func DecodeWith(body []byte, options Options) ([]Metric, error) {
+	d := frameDecoder{codec: options.FrameEncoding, zstd: zstdDecoder}
+	if options.ZstdDictionary != nil {
+		dictDecoder, err := zstd.NewReader(nil, zstd.WithDecoderDicts(options.ZstdDictionary))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd dictionary: %w", err)
+		}
+		defer dictDecoder.Close()
+		d.zstd = dictDecoder
+	}
+
+	body, err := d.decompress(options.ContentEncoding, body)
+	if err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+
+	var metrics []Metric
+	offset := 0
+	for offset < len(body) {
+		m, n, err := d.decodeFrame(body[offset:])
+		if err != nil {
+			return metrics, &FrameError{len(metrics), offset, err}
+		}
+		metrics = append(metrics, m)
+		offset += n
+	}
+	return metrics, nil
+}
+
+type frameDecoder struct {
+	codec gostatok.Codec
+	zstd  *zstd.Decoder
+}
+
+func (d frameDecoder) decompress(codec gostatok.Codec, data []byte) ([]byte, error) {
+	switch codec {
+	case gostatok.CodecZstd:
+		return d.zstd.DecodeAll(data, nil)
+	case gostatok.CodecSnappy:
+		return snappy.Decode(nil, data)
+	case gostatok.CodecGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(reader)
+	case gostatok.CodecNone:
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unknown codec %d", codec)
+	}
+}
+
+func (d frameDecoder) decodeFrame(frame []byte) (Metric, int, error) {
+	var m Metric
+
+	var fields [3][]byte
+	rest := frame
+	for i := range fields {
+		comma := bytes.IndexByte(rest, ',')
+		if comma < 0 {
+			return m, 0, fmt.Errorf("missing field #%d", i)
+		}
+		fields[i], rest = rest[:comma], rest[comma+1:]
+	}
+
+	clientID, err := strconv.Atoi(string(fields[0]))
+	if err != nil {
+		return m, 0, fmt.Errorf("invalid client id %q", fields[0])
+	}
+	m.ClientID = clientID
+
+	m.Name = string(fields[1])
+	if m.Name == "" {
+		return m, 0, fmt.Errorf("empty metric name")
+	}
+
+	length, err := strconv.Atoi(string(fields[2]))
+	if err != nil || length < 0 || length > len(rest) {
+		return m, 0, fmt.Errorf("metric %s: invalid payload length %q", m.Name, fields[2])
+	}
+
+	payload, err := d.decompress(d.codec, rest[:length])
+	if err != nil {
+		return m, 0, fmt.Errorf("metric %s: %w", m.Name, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&m.Accums); err != nil {
+		return m, 0, fmt.Errorf("metric %s: invalid JSON: %w", m.Name, err)
+	}
+	if dec.More() {
+		return m, 0, fmt.Errorf("metric %s: trailing data after JSON", m.Name)
+	}
+
+	for i, a := range m.Accums {
+		if err = validateAccum(a); err != nil {
+			return m, 0, fmt.Errorf("metric %s accum #%d: %w", m.Name, i, err)
+		}
+	}
+
+	return m, len(frame) - len(rest) + length, nil
+}
+
+func validateAccum(a Accum) error {
+	if !slices.Contains(gostatok.Steps[:], gostatok.Step(a.Step)) {
+		return fmt.Errorf("unknown step %d", a.Step)
+	}
+	if a.LabelKeys != nil && len(a.LabelKeys) != len(a.Labels) {
+		return fmt.Errorf("%d label keys for %d labels", len(a.LabelKeys), len(a.Labels))
+	}
+	if a.SampleRate < 0 || a.SampleRate > 1 {
+		return fmt.Errorf("invalid sample rate %v", a.SampleRate)
+	}
+	for _, p := range a.Percentiles {
+		if !(p > 0 && p < 1) {
+			return fmt.Errorf("invalid percentile %v", p)
+		}
+	}
+	if a.Values != nil && len(a.Values) != 3+len(a.PercentilesOrDefault()) {
+		return fmt.Errorf("%d values, expected %d", len(a.Values), 3+len(a.PercentilesOrDefault()))
+	}
+	return nil
+}
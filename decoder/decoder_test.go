@@ -0,0 +1,72 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+func frame(clientID int, name, payload string) []byte {
+	compressed := zstdEncoder.EncodeAll([]byte(payload), nil)
+	return append([]byte(fmt.Sprintf("%d,%s,%d,", clientID, name, len(compressed))), compressed...)
+}
+
+func TestDecode(t *testing.T) {
+	body := frame(7, "requests", `[{"t":1,"s":10,"k":["route"],"l":["/a"],"c":3,"r":0.5}]`)
+	body = append(body, frame(7, "latency", `[{"t":2,"s":60,"l":["x"],"c":2,"v":[1,0,2,1,1,2,2]}]`)...)
+	body = append(body, frame(7, "size", `[{"t":2,"s":60,"c":2,"p":[0.9],"v":[1,0,2,2]}]`)...)
+
+	metrics, err := Decode(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 3 {
+		t.Fatalf("got %d metrics", len(metrics))
+	}
+	if m := metrics[0]; m.ClientID != 7 || m.Name != "requests" || m.Accums[0].Counter != 3 || m.Accums[0].SampleRate != 0.5 || m.Accums[0].LabelKeys[0] != "route" {
+		t.Errorf("unexpected first metric %+v", m)
+	}
+	if m := metrics[1]; m.Name != "latency" || len(m.Accums[0].Values) != 7 || m.Accums[0].Values[2] != 2 {
+		t.Errorf("unexpected second metric %+v", m)
+	}
+	if a := metrics[2].Accums[0]; len(a.Values) != 4 || a.PercentilesOrDefault()[0] != 0.9 || len(metrics[1].Accums[0].PercentilesOrDefault()) != 4 {
+		t.Errorf("unexpected percentiles %+v", a)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	valid := frame(1, "ok", `[{"t":1,"s":10,"c":1}]`)
+
+	cases := map[string][]byte{
+		"missing field": []byte("1,name"),
+		"bad client id": []byte("x,name,0,"),
+		"bad length":    []byte("1,name,100,abc"),
+		"not zstd":      []byte("1,name,3,abc"),
+		"unknown field": frame(1, "m", `[{"t":1,"s":10,"c":1,"z":1}]`),
+		"unknown step":  frame(1, "m", `[{"t":1,"s":5,"c":1}]`),
+		"label keys":    frame(1, "m", `[{"t":1,"s":10,"k":["a","b"],"l":["x"],"c":1}]`),
+		"values count":  frame(1, "m", `[{"t":1,"s":10,"c":1,"v":[1,2]}]`),
+		"percentiles":   frame(1, "m", `[{"t":1,"s":10,"c":1,"p":[0.9],"v":[1,2,3,4,5,6,7]}]`),
+		"percentile":    frame(1, "m", `[{"t":1,"s":10,"c":1,"p":[90],"v":[1,2,3,4]}]`),
+		"trailing json": frame(1, "m", `[] []`),
+	}
+	for name, bad := range cases {
+		t.Run(name, func(t *testing.T) {
+			metrics, err := Decode(append(append([]byte{}, valid...), bad...))
+			var frameErr *FrameError
+			if !errors.As(err, &frameErr) {
+				t.Fatalf("expected FrameError, got %v", err)
+			}
+			if frameErr.Frame != 1 || frameErr.Offset != len(valid) {
+				t.Errorf("unexpected position %+v", frameErr)
+			}
+			if len(metrics) != 1 || metrics[0].Name != "ok" {
+				t.Errorf("expected the valid frame to be returned, got %+v", metrics)
+			}
+		})
+	}
+}
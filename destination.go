@@ -0,0 +1,303 @@
+package gostatok
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DestinationMode defines how the batches are sent to Options.Destinations
+type DestinationMode uint8
+
+const (
+	// DestinationFailover sends every batch to the first healthy destination, trying the next one on failure.
+	// A failing destination is skipped for Options.DestinationProbeInterval, then the next batch probes it again.
+	DestinationFailover DestinationMode = iota
+	// DestinationFanOut sends every batch to all the destinations independently, e.g. to prod and a staging mirror.
+	// A slow destination doesn't delay the others, its batches are dropped once its queue is full.
+	DestinationFanOut
+)
+
+const defaultEndpoint = "https://statok.dev0101.xyz"
+const defaultDestinationProbeInterval = time.Second * 30
+
+// A destination is marked unhealthy after this many consecutive failed attempts
+const unhealthyAfterFailures = 2
+
+func (m DestinationMode) String() string {
+	switch m {
+	case DestinationFailover:
+		return "failover"
+	case DestinationFanOut:
+		return "fan_out"
+	default:
+		return "unknown"
+	}
+}
+
+// DestinationStats are the delivery statistics of a destination, see Client.DestinationStats
+type DestinationStats struct {
+	Endpoint string
+	Healthy  bool
+	// Sent is the number of the batches delivered
+	Sent uint64
+	// Failures is the number of the failed attempts, including the retried ones
+	Failures uint64
+	// Dropped is the number of the batches given up on after the last attempt to this destination failed,
+	// or dropped because the fan-out queue of the destination was full
+	Dropped     uint64
+	LastError   error
+	LastSuccess time.Time
+	LastFailure time.Time
+}
+
+type destination struct {
+	endpoint string
+
+	// The fan-out queue, nil in the failover mode
+	queue chan *sharedBatch
+	// The fan-out spool, see Options.SpoolDir
+	spool *spool
+
+	mx                  sync.Mutex
+	stats               DestinationStats
+	consecutiveFailures int
+	probeAt             time.Time
+}
+
+func newDestination(endpoint string) *destination {
+	return &destination{
+		endpoint: endpoint,
+		stats:    DestinationStats{Endpoint: endpoint, Healthy: true},
+	}
+}
+
+func (c *Client) send(d *destination, data *bytes.Buffer, encoding batchEncoding) error {
+	err := c.sendToAPI(d.endpoint, data, encoding)
+	now := c.clock.Now()
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if err == nil {
+		d.stats.Sent++
+		d.stats.Healthy = true
+		d.stats.LastSuccess = now
+		d.consecutiveFailures = 0
+		return nil
+	}
+
+	d.stats.Failures++
+	d.stats.LastError = err
+	d.stats.LastFailure = now
+	d.consecutiveFailures++
+	if d.consecutiveFailures >= unhealthyAfterFailures || !d.stats.Healthy {
+		d.stats.Healthy = false
+		d.probeAt = now.Add(c.destinationProbeInterval)
+	}
+	return err
+}
+
+func (d *destination) addDropped() {
+	d.mx.Lock()
+	d.stats.Dropped++
+	d.mx.Unlock()
+}
+
+// isAvailable reports whether the destination is healthy or is due to be probed
+func (d *destination) isAvailable(now time.Time) bool {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return d.stats.Healthy || !now.Before(d.probeAt)
+}
+
+// DestinationStats returns the delivery statistics of every destination in the order of Options.Destinations
+func (c *Client) DestinationStats() []DestinationStats {
+	stats := make([]DestinationStats, len(c.destinations))
+	for i, d := range c.destinations {
+		d.mx.Lock()
+		stats[i] = d.stats
+		d.mx.Unlock()
+	}
+	return stats
+}
+
+// availableDestinations returns the destinations available for the failover, all of them if none is available
+func (c *Client) availableDestinations() []*destination {
+	now := c.clock.Now()
+	candidates := make([]*destination, 0, len(c.destinations))
+	for _, d := range c.destinations {
+		if d.isAvailable(now) {
+			candidates = append(candidates, d)
+		}
+	}
+	if len(candidates) == 0 {
+		return c.destinations
+	}
+	return candidates
+}
+
+// sendFailover tries the available destinations in order, spooling the batch if all the attempts fail
+func (c *Client) sendFailover(data *bytes.Buffer, encoding batchEncoding) error {
+	var err error
+	var last *destination
+	for try := 0; try < sendTries; try++ {
+		if try > 0 {
+			time.Sleep(c.retryDelay)
+		}
+
+		for _, d := range c.availableDestinations() {
+			if err = c.send(d, data, encoding); err == nil {
+				return nil
+			}
+			last = d
+			c.logger.printf(LogLevelDebug, "statok: send attempt %d to %s failed: %v", try+1, d.endpoint, err)
+		}
+	}
+
+	if c.spool != nil {
+		spoolErr := c.spool.save(data.Bytes(), encoding)
+		if spoolErr == nil {
+			c.logger.printf(LogLevelWarn, "statok: batch of %d bytes spooled: %v", data.Len(), err)
+			return err
+		}
+		c.logger.printf(LogLevelWarn, "statok: failed to spool batch: %v", spoolErr)
+	}
+
+	last.addDropped()
+	c.logger.printf(LogLevelWarn, "statok: batch of %d bytes dropped: %v", data.Len(), err)
+	return err
+}
+
+// resendSpooled sends the batches of the failover spool once, to the first available destination which accepts them
+func (c *Client) resendSpooled() {
+	if c.spool == nil {
+		return
+	}
+	err := c.spool.resend(func(data *bytes.Buffer, encoding batchEncoding) error {
+		var err error
+		for _, d := range c.availableDestinations() {
+			if err = c.send(d, data, encoding); err == nil {
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		c.logger.printf(LogLevelDebug, "statok: failed to resend spooled batches: %v", err)
+	}
+}
+
+// sharedBatch is a batch sent to all the destinations in the fan-out mode
+type sharedBatch struct {
+	sendBatch
+
+	pending atomic.Int32
+	mx      sync.Mutex
+	errs    []error
+}
+
+// done records the result of a destination, the last one releases the batch and reports the joined errors
+func (b *sharedBatch) done(err error) {
+	if err != nil {
+		b.mx.Lock()
+		b.errs = append(b.errs, err)
+		b.mx.Unlock()
+	}
+	if b.pending.Add(-1) > 0 {
+		return
+	}
+
+	if b.data != nil {
+		bytesBufferPool.Put(b.data)
+	}
+	if b.flushed != nil {
+		b.flushed <- errors.Join(b.errs...)
+	}
+}
+
+func (c *Client) fanOut(batch sendBatch) {
+	shared := &sharedBatch{sendBatch: batch}
+	shared.pending.Store(int32(len(c.destinations)))
+
+	for _, d := range c.destinations {
+		if batch.flushed != nil {
+			// Flush waits for the earlier batches of every destination
+			select {
+			case d.queue <- shared:
+			case <-c.stop:
+				shared.done(ErrClientClosed)
+			}
+			continue
+		}
+
+		select {
+		case d.queue <- shared:
+		default:
+			d.addDropped()
+			c.logger.printf(LogLevelWarn, "statok: batch of %d bytes dropped for %s: queue is full", batch.data.Len(), d.endpoint)
+			shared.done(ErrDroppedEvent)
+		}
+	}
+}
+
+func (c *Client) startDestinationSender(d *destination) {
+	c.resendSpooledTo(d)
+
+	for {
+		var batch *sharedBatch
+		select {
+		case batch = <-d.queue:
+		case <-c.stop:
+			return
+		}
+
+		var err error
+		if batch.data != nil {
+			for try := 0; try < sendTries; try++ {
+				if try > 0 {
+					time.Sleep(c.retryDelay)
+				}
+				if err = c.send(d, batch.data, batch.encoding); err == nil {
+					break
+				}
+				c.logger.printf(LogLevelDebug, "statok: send attempt %d to %s failed: %v", try+1, d.endpoint, err)
+			}
+			if err == nil {
+				c.resendSpooledTo(d)
+			} else if !c.spoolFor(d, batch.sendBatch, err) {
+				d.addDropped()
+				c.logger.printf(LogLevelWarn, "statok: batch of %d bytes dropped for %s: %v", batch.data.Len(), d.endpoint, err)
+			}
+		}
+		batch.done(err)
+	}
+}
+
+// spoolFor saves the batch which could not be sent to the fan-out destination, it reports whether it's saved
+func (c *Client) spoolFor(d *destination, batch sendBatch, sendErr error) bool {
+	if d.spool == nil {
+		return false
+	}
+	if err := d.spool.save(batch.data.Bytes(), batch.encoding); err != nil {
+		c.logger.printf(LogLevelWarn, "statok: failed to spool batch for %s: %v", d.endpoint, err)
+		return false
+	}
+	c.logger.printf(LogLevelWarn, "statok: batch of %d bytes spooled for %s: %v", batch.data.Len(), d.endpoint, sendErr)
+	return true
+}
+
+// resendSpooledTo sends the spooled batches of the fan-out destination once
+func (c *Client) resendSpooledTo(d *destination) {
+	if d.spool == nil {
+		return
+	}
+	err := d.spool.resend(func(data *bytes.Buffer, encoding batchEncoding) error {
+		return c.send(d, data, encoding)
+	})
+	if err != nil {
+		c.logger.printf(LogLevelDebug, "statok: failed to resend spooled batches to %s: %v", d.endpoint, err)
+	}
+}
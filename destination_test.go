@@ -0,0 +1,93 @@
+package gostatok_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+func TestDestinationFailover(t *testing.T) {
+	primary := statoktest.NewIngestServer("1_test")
+	defer primary.Close()
+	secondary := statoktest.NewIngestServer("1_test")
+	defer secondary.Close()
+
+	clock := statoktest.NewFakeClock(testStart)
+	client := gostatok.NewClient(gostatok.Options{
+		APIKey:                   "1_test",
+		Destinations:             []string{primary.URL(), secondary.URL()},
+		DestinationProbeInterval: time.Minute,
+		RetryDelay:               time.Millisecond,
+		Clock:                    clock,
+	})
+	defer client.Close(context.Background())
+
+	flush := func() {
+		t.Helper()
+		client.Event("jobs", 1)
+		if err := client.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	primary.FailNext(2, 503)
+
+	// The first failure fails over only this batch, the second one marks the primary unhealthy
+	flush()
+	flush()
+	if stats := client.DestinationStats(); stats[0].Healthy || stats[0].Failures != 2 || stats[1].Sent != 2 {
+		t.Fatalf("unexpected stats after the failures: %+v", stats)
+	}
+
+	// The unhealthy primary is skipped until the probe interval passes
+	flush()
+	if primary.Requests() != 2 || len(secondary.Metrics()) != 3 {
+		t.Fatalf("unhealthy primary wasn't skipped: %d requests", primary.Requests())
+	}
+
+	clock.Advance(time.Minute)
+	flush()
+	if stats := client.DestinationStats(); !stats[0].Healthy || stats[0].Sent != 1 || len(primary.Metrics()) != 1 {
+		t.Fatalf("primary didn't recover: %+v", stats)
+	}
+}
+
+func TestDestinationFanOut(t *testing.T) {
+	prod := statoktest.NewIngestServer("1_test")
+	defer prod.Close()
+	mirror := statoktest.NewIngestServer("1_test")
+	defer mirror.Close()
+
+	client := gostatok.NewClient(gostatok.Options{
+		APIKey:          "1_test",
+		Destinations:    []string{prod.URL(), mirror.URL()},
+		DestinationMode: gostatok.DestinationFanOut,
+		RetryDelay:      time.Millisecond,
+		LogLevel:        gostatok.LogLevelOff,
+	})
+	defer client.Close(context.Background())
+
+	client.Event("jobs", 1)
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(prod.Metrics()) != 1 || len(mirror.Metrics()) != 1 {
+		t.Fatalf("batch wasn't sent to every destination: %d, %d", len(prod.Metrics()), len(mirror.Metrics()))
+	}
+
+	// A failing mirror doesn't affect prod
+	mirror.FailNext(3, 500)
+	client.Event("jobs", 1)
+	if err := client.Flush(context.Background()); err == nil {
+		t.Fatal("expected the mirror failure to be reported")
+	}
+	if len(prod.Metrics()) != 2 {
+		t.Fatalf("prod didn't receive the batch: %d", len(prod.Metrics()))
+	}
+	if stats := client.DestinationStats(); stats[0].Sent != 2 || stats[1].Sent != 1 || stats[1].Dropped != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
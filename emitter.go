@@ -0,0 +1,67 @@
+package gostatok
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// Emitter is the event API of Client. The integrations accept it instead of *Client, so the instrumented
+// code can be unit-tested with statoktest.Recorder.
+type Emitter interface {
+	Event(metricName string, value uint32, labels ...string)
+	EventWithError(metricName string, value uint32, labels ...string) error
+	EventCtx(ctx context.Context, metricName string, value uint32, labels ...string) error
+
+	EventValue(metricName string, value float32, labels ...string)
+	EventValueWithError(metricName string, value float32, labels ...string) error
+	EventValueCtx(ctx context.Context, metricName string, value float32, labels ...string) error
+
+	EventLabels(metricName string, value uint32, labels Labels)
+	EventLabelsWithError(metricName string, value uint32, labels Labels) error
+	EventLabelsCtx(ctx context.Context, metricName string, value uint32, labels Labels) error
+
+	EventValueLabels(metricName string, value float32, labels Labels)
+	EventValueLabelsWithError(metricName string, value float32, labels Labels) error
+	EventValueLabelsCtx(ctx context.Context, metricName string, value float32, labels Labels) error
+
+	EventBatch(events []BatchEvent) error
+	EventBatchCtx(ctx context.Context, events []BatchEvent) error
+	EventBatchPartial(ctx context.Context, events []BatchEvent) (int, error)
+}
+
+var _ Emitter = (*Client)(nil)
+
+// EventBatchBySeries sends the events with one EventBatchCtx. A single invalid event rejects the whole batch,
+// so on a *ValidationError the runs of consecutive events of the same series are resent separately, and
+// the invalid event drops only the events of its series.
+// It returns the indexes of the rejected events and the first error which is not a *ValidationError.
+func EventBatchBySeries(ctx context.Context, emitter Emitter, events []BatchEvent) ([]int, error) {
+	var validationErr *ValidationError
+	if err := emitter.EventBatchCtx(ctx, events); !errors.As(err, &validationErr) {
+		return nil, err
+	}
+
+	var rejected []int
+	var firstErr error
+	start := 0
+	for i := range events {
+		if i+1 < len(events) && sameSeries(events[i], events[i+1]) {
+			continue
+		}
+		err := emitter.EventBatchCtx(ctx, events[start:i+1])
+		if errors.As(err, &validationErr) {
+			for j := start; j <= i; j++ {
+				rejected = append(rejected, j)
+			}
+		} else if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		start = i + 1
+	}
+	return rejected, firstErr
+}
+
+func sameSeries(a, b BatchEvent) bool {
+	return a.MetricName == b.MetricName && slices.Equal(a.LabelKeys, b.LabelKeys) && slices.Equal(a.Labels, b.Labels)
+}
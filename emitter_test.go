@@ -0,0 +1,46 @@
+package gostatok_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+func TestEventBatchBySeries(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+	recorder.Reject(func(e statoktest.Event) error {
+		if e.MetricName == "invalid" {
+			return &gostatok.ValidationError{Rule: gostatok.RuleNameChars, MetricName: e.MetricName, LabelIndex: -1}
+		}
+		return nil
+	})
+
+	events := []gostatok.BatchEvent{
+		gostatok.ValueEvent("latency", 1, "a"),
+		gostatok.ValueEvent("latency", 2, "a"),
+		gostatok.CounterEvent("invalid", 1),
+		gostatok.CounterEvent("invalid", 2),
+		gostatok.ValueEvent("latency", 3, "b"),
+	}
+	rejected, err := gostatok.EventBatchBySeries(context.Background(), recorder, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rejected, []int{2, 3}) {
+		t.Fatalf("unexpected rejected events: %v", rejected)
+	}
+	recorder.AssertValues(t, "latency", []string{"a"}, []float32{1, 2})
+	recorder.AssertValues(t, "latency", []string{"b"}, []float32{3})
+	recorder.AssertNoEvents(t, "invalid")
+
+	// The other errors are returned
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := gostatok.EventBatchBySeries(ctx, recorder, events); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+}
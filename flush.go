@@ -0,0 +1,101 @@
+package gostatok
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrClientClosed = errors.New("client closed")
+
+// Flush sends all the accumulated events, including the ones of the current time windows, and waits until
+// they are sent or the context is done. The events enqueued after Flush was called may be sent separately.
+// Returns the error of the last attempt if the batch could not be sent.
+//
+// The accums of the current time windows are sent as they are, so the later events of the same windows
+// are sent as separate accums. It's meant for the short-lived processes and the shutdown, not for the regular use.
+func (c *Client) Flush(ctx context.Context) error {
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+	return c.flush(ctx)
+}
+
+func (c *Client) flush(ctx context.Context) error {
+	flushed := make(chan error, 1)
+
+	select {
+	case c.eventsChan <- eventEntry{flushed: flushed}:
+	case <-c.stop:
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-flushed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes the accumulated events like Flush and stops the background goroutines of the client.
+// The events sent after Close return ErrClientClosed, the repeated calls return nil.
+// The events enqueued concurrently with Close are flushed too if they make it into the queue before
+// the goroutines stop, otherwise they are dropped and counted in the returned ErrDroppedEvent.
+func (c *Client) Close(ctx context.Context) error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+
+	err := c.flush(ctx)
+	// The producers which passed the closed check before Close may have enqueued behind the flush marker
+	if err == nil && (len(c.eventsChan) > 0 || c.unflushed.Load() > 0) {
+		err = c.flush(ctx)
+	}
+	close(c.stop)
+	<-c.collectorDone
+
+	if dropped := c.dropQueued(); dropped > 0 {
+		err = errors.Join(err, fmt.Errorf("%w: %d events enqueued while closing were not flushed", ErrDroppedEvent, dropped))
+	}
+	return err
+}
+
+// dropQueued empties the events queue after the collector has exited. It returns the number of the events
+// dropped with it and the ones collected but not flushed.
+func (c *Client) dropQueued() int64 {
+	dropped := c.unflushed.Load()
+	for {
+		select {
+		case entry := <-c.eventsChan:
+			if entry.flushed != nil {
+				entry.flushed <- ErrClientClosed
+			} else {
+				dropped += int64(max(1, len(entry.batch)))
+			}
+		default:
+			return dropped
+		}
+	}
+}
+
+// flushAccums serializes all the accums and queues them for sending, flushed receives the result
+func (c *Client) flushAccums(flushed chan error) {
+	batch := func() sendBatch {
+		c.metricAccumsMx.Lock()
+		defer c.metricAccumsMx.Unlock()
+
+		return c.serializeAccums(true)
+	}()
+	batch.flushed = flushed
+	c.unflushed.Store(0)
+
+	// An empty batch still goes through the queue, so the result is reported after the earlier batches are sent
+	select {
+	case c.sendQueue <- batch:
+	case <-c.stop:
+		flushed <- ErrClientClosed
+	}
+}
@@ -2,11 +2,24 @@ module github.com/statxyz/statok-go
 
 go 1.22
 
+require (
+	github.com/golang/snappy v0.0.4
+	github.com/klauspost/compress v1.17.9
+	go.opentelemetry.io/otel v1.31.0
+	go.opentelemetry.io/otel/sdk/metric v1.31.0
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
 require (
 	github.com/caio/go-tdigest v3.1.0+incompatible // indirect
 	github.com/gammazero/deque v0.2.1 // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/goccy/go-json v0.10.3 // indirect
-	github.com/golang/snappy v0.0.4 // indirect
-	github.com/klauspost/compress v1.17.9 // indirect
-	google.golang.org/protobuf v1.34.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/otel/metric v1.31.0 // indirect
+	go.opentelemetry.io/otel/sdk v1.31.0 // indirect
+	go.opentelemetry.io/otel/trace v1.31.0 // indirect
+	golang.org/x/sys v0.26.0 // indirect
 )
@@ -0,0 +1,99 @@
+package gostatok
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// Label is a named label, see Labels
+type Label struct {
+	Key   string
+	Value string
+}
+
+// Labels is a set of named labels. It is canonicalised by the key order before aggregation, so the order in
+// which the labels are passed never creates new series. If a key is repeated, the last value wins.
+type Labels []Label
+
+// L makes Labels from key, value pairs, e.g. L("method", "GET", "status", "2xx").
+// A key without a value gets an empty value.
+func L(kv ...string) Labels {
+	labels := make(Labels, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		l := Label{Key: kv[i]}
+		if i+1 < len(kv) {
+			l.Value = kv[i+1]
+		}
+		labels = append(labels, l)
+	}
+	return labels
+}
+
+// Split returns the canonical keys and values of the labels. The values can be passed to the positional
+// API, although the series will be different from the named one, as the keys are part of the series identity.
+func (l Labels) Split() (keys []string, values []string) {
+	if len(l) == 0 {
+		return nil, nil
+	}
+
+	sorted := slices.Clone(l)
+	slices.SortStableFunc(sorted, func(a, b Label) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	keys = make([]string, 0, len(sorted))
+	values = make([]string, 0, len(sorted))
+	for i, label := range sorted {
+		if i+1 < len(sorted) && sorted[i+1].Key == label.Key {
+			continue
+		}
+		keys = append(keys, label.Key)
+		values = append(values, label.Value)
+	}
+	return keys, values
+}
+
+// Values returns the canonical values of the labels, see Split
+func (l Labels) Values() []string {
+	_, values := l.Split()
+	return values
+}
+
+func (c *Client) EventLabels(metricName string, value uint32, labels Labels) {
+	_ = c.EventLabelsWithError(metricName, value, labels)
+}
+
+func (c *Client) EventLabelsWithError(metricName string, value uint32, labels Labels) error {
+	return c.EventLabelsCtx(context.Background(), metricName, value, labels)
+}
+
+func (c *Client) EventLabelsCtx(ctx context.Context, metricName string, value uint32, labels Labels) error {
+	keys, values := labels.Split()
+	return c.enqueueCounter(ctx, metricName, keys, values, value)
+}
+
+func (c *Client) EventValueLabels(metricName string, value float32, labels Labels) {
+	_ = c.EventValueLabelsWithError(metricName, value, labels)
+}
+
+func (c *Client) EventValueLabelsWithError(metricName string, value float32, labels Labels) error {
+	return c.EventValueLabelsCtx(context.Background(), metricName, value, labels)
+}
+
+func (c *Client) EventValueLabelsCtx(ctx context.Context, metricName string, value float32, labels Labels) error {
+	keys, values := labels.Split()
+	return c.enqueueValue(ctx, metricName, keys, values, value)
+}
+
+// CounterEventLabels is CounterEvent with named labels
+func CounterEventLabels(metricName string, value uint32, labels Labels) BatchEvent {
+	keys, values := labels.Split()
+	return BatchEvent{MetricName: metricName, LabelKeys: keys, Labels: values, Counter: value}
+}
+
+// ValueEventLabels is ValueEvent with named labels
+func ValueEventLabels(metricName string, value float32, labels Labels) BatchEvent {
+	keys, values := labels.Split()
+	return BatchEvent{MetricName: metricName, LabelKeys: keys, Labels: values, Value: value, IsValue: true}
+}
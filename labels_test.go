@@ -0,0 +1,22 @@
+package gostatok
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLabelsSplit(t *testing.T) {
+	keys, values := L("status", "2xx", "method", "GET", "route", "/a", "method", "POST").Split()
+
+	if !slices.Equal(keys, []string{"method", "route", "status"}) {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	if !slices.Equal(values, []string{"POST", "/a", "2xx"}) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	keys2, values2 := L("route", "/a", "method", "POST", "status", "2xx").Split()
+	if !slices.Equal(keys, keys2) || !slices.Equal(values, values2) {
+		t.Fatalf("labels order must not matter: %v %v", keys2, values2)
+	}
+}
@@ -0,0 +1,54 @@
+package gostatok
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// LogLevel is the min level of the client log messages
+type LogLevel int8
+
+const (
+	// LogLevelWarn logs the events that couldn't be delivered
+	LogLevelWarn LogLevel = iota
+	// LogLevelOff disables the client log messages
+	LogLevelOff
+	// LogLevelDebug logs every failed send attempt as well
+	LogLevelDebug LogLevel = -1
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelOff:
+		return "off"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseLogLevel parses the LogLevel names: debug, warn and off
+func ParseLogLevel(s string) (LogLevel, error) {
+	for _, l := range [...]LogLevel{LogLevelDebug, LogLevelWarn, LogLevelOff} {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// logger writes the client messages to the standard logger
+type logger struct {
+	level LogLevel
+}
+
+func (l logger) printf(level LogLevel, format string, args ...any) {
+	if level < l.level || l.level == LogLevelOff {
+		return
+	}
+	log.Printf(format, args...)
+}
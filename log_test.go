@@ -0,0 +1,55 @@
+package gostatok_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+func TestLogLevel(t *testing.T) {
+	var output bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&output)
+
+	for _, level := range []gostatok.LogLevel{gostatok.LogLevelDebug, gostatok.LogLevelWarn, gostatok.LogLevelOff} {
+		t.Run(level.String(), func(t *testing.T) {
+			server := statoktest.NewIngestServer("1_test")
+			defer server.Close()
+
+			client := gostatok.NewClient(gostatok.Options{
+				APIKey:     "1_test",
+				Endpoint:   server.URL(),
+				RetryDelay: time.Millisecond,
+				LogLevel:   level,
+			})
+			defer client.Close(context.Background())
+
+			output.Reset()
+			server.FailNext(3, 503)
+			client.Event("jobs", 1)
+			_ = client.Flush(context.Background())
+
+			attempts := strings.Count(output.String(), "send attempt")
+			dropped := strings.Count(output.String(), "dropped")
+			switch {
+			case level == gostatok.LogLevelDebug && (attempts != 3 || dropped != 1),
+				level == gostatok.LogLevelWarn && (attempts != 0 || dropped != 1),
+				level == gostatok.LogLevelOff && output.Len() != 0:
+				t.Fatalf("unexpected log output at %s:\n%s", level, output.String())
+			}
+		})
+	}
+
+	if level, err := gostatok.ParseLogLevel("DEBUG"); err != nil || level != gostatok.LogLevelDebug {
+		t.Fatalf("unexpected parsed level %s: %v", level, err)
+	}
+	if _, err := gostatok.ParseLogLevel("loud"); err == nil {
+		t.Fatal("expected an error for an unknown level")
+	}
+}
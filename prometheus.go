@@ -0,0 +1,208 @@
+package gostatok
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/statxyz/statok-go/approx"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// promSeries is the cumulative state of a series since the client start
+type promSeries struct {
+	metricName string
+	labelKeys  []string
+	labels     []string
+	isValue    bool
+	// Estimated by the sample rates, rounded when exposed
+	count float64
+	sum   float64
+}
+
+func promSeriesKey(entry *eventEntry) string {
+	var sb strings.Builder
+	sb.WriteString(entry.metricName)
+	if entry.counter == 0 {
+		sb.WriteString("\x00v")
+	}
+	for _, k := range entry.labelKeys {
+		sb.WriteString("\x00k")
+		sb.WriteString(k)
+	}
+	for _, l := range entry.labels {
+		sb.WriteString("\x00l")
+		sb.WriteString(l)
+	}
+	return sb.String()
+}
+
+// collectPromSeries updates the cumulative state of the event series, metricAccumsMx must be held
+func (c *Client) collectPromSeries(entry eventEntry) {
+	key := promSeriesKey(&entry)
+
+	s := c.promSeries[key]
+	if s == nil {
+		s = &promSeries{
+			metricName: entry.metricName,
+			labelKeys:  entry.labelKeys,
+			labels:     entry.labels,
+			isValue:    entry.counter == 0,
+		}
+		c.promSeries[key] = s
+	}
+
+	if s.isValue {
+		s.count += scaleBySampleRate(1, entry.sampleRate)
+		s.sum += float64(entry.value) * scaleBySampleRate(1, entry.sampleRate)
+	} else {
+		s.count += scaleBySampleRate(entry.counter, entry.sampleRate)
+	}
+}
+
+// PrometheusHandler renders the aggregation state in the Prometheus text exposition format. Counters are
+// exposed as "<name>_total" counters since the client start, values as summaries with Options.Percentiles
+// quantiles of the current minute, or of the shortest of Options.Steps without Step60s.
+// Positional labels are named "label0", "label1", ...
+// It requires Options.PrometheusExposition, otherwise nothing is exposed.
+func (c *Client) PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bb := bytesBufferPool.Get()
+		bb.Reset()
+		defer bytesBufferPool.Put(bb)
+
+		c.writePrometheus(bb)
+
+		w.Header().Set("Content-Type", prometheusContentType)
+		_, _ = w.Write(bb.Bytes())
+	})
+}
+
+func (c *Client) writePrometheus(bb *bytes.Buffer) {
+	c.metricAccumsMx.Lock()
+	defer c.metricAccumsMx.Unlock()
+
+	series := make([]*promSeries, 0, len(c.promSeries))
+	for _, s := range c.promSeries {
+		series = append(series, s)
+	}
+	slices.SortFunc(series, func(a, b *promSeries) int {
+		if a.metricName != b.metricName {
+			return strings.Compare(a.metricName, b.metricName)
+		}
+		if a.isValue != b.isValue {
+			if a.isValue {
+				return 1
+			}
+			return -1
+		}
+		if n := slices.Compare(a.labelKeys, b.labelKeys); n != 0 {
+			return n
+		}
+		return slices.Compare(a.labels, b.labels)
+	})
+
+	prevFamily := ""
+	for _, s := range series {
+		name := promMetricName(s.metricName)
+		family := name + "_total"
+		if s.isValue {
+			family = name
+		}
+
+		if family != prevFamily {
+			if s.isValue {
+				bb.WriteString("# TYPE " + name + " summary\n")
+			} else {
+				bb.WriteString("# TYPE " + family + " counter\n")
+			}
+			prevFamily = family
+		}
+
+		if !s.isValue {
+			writePromSample(bb, family, s, "", strconv.FormatUint(uint64(math.Round(s.count)), 10))
+			continue
+		}
+
+		if digest := c.currentDigest(s); digest != nil {
+			digest.Result(func(f float32, i int) {
+				// The first 3 results are avg, min and max
+				if i >= 3 {
+					quantile := strconv.FormatFloat(float64(digest.Percentiles()[i-3]), 'g', -1, 32)
+					writePromSample(bb, name, s, quantile, strconv.FormatFloat(float64(f), 'g', -1, 32))
+				}
+			})
+		}
+		writePromSample(bb, name+"_sum", s, "", strconv.FormatFloat(s.sum, 'g', -1, 64))
+		writePromSample(bb, name+"_count", s, "", strconv.FormatUint(uint64(math.Round(s.count)), 10))
+	}
+}
+
+// currentDigest returns the digest of the current promStep window of the series, nil if there were no values
+func (c *Client) currentDigest(s *promSeries) *approx.ValuesDigest {
+	m := c.metricAccumsMap[s.metricName]
+	if m == nil {
+		return nil
+	}
+
+	var digest *approx.ValuesDigest
+	timeIndex := -1
+	for _, a := range m.accums {
+		if a.step != c.promStep || a.digest == nil || a.timeIndex < timeIndex {
+			continue
+		}
+		if slices.Equal(a.labels, s.labels) && slices.Equal(a.labelKeys, s.labelKeys) {
+			digest = a.digest
+			timeIndex = a.timeIndex
+		}
+	}
+	return digest
+}
+
+func writePromSample(bb *bytes.Buffer, name string, s *promSeries, quantile string, value string) {
+	bb.WriteString(name)
+
+	if len(s.labels) > 0 || quantile != "" {
+		bb.WriteString("{")
+		for i, l := range s.labels {
+			if i > 0 {
+				bb.WriteString(",")
+			}
+			if s.labelKeys != nil {
+				bb.WriteString(promMetricName(s.labelKeys[i]))
+			} else {
+				bb.WriteString("label" + strconv.Itoa(i))
+			}
+			bb.WriteString(`="`)
+			bb.WriteString(promLabelValueReplacer.Replace(l))
+			bb.WriteString(`"`)
+		}
+		if quantile != "" {
+			if len(s.labels) > 0 {
+				bb.WriteString(",")
+			}
+			bb.WriteString(`quantile="` + quantile + `"`)
+		}
+		bb.WriteString("}")
+	}
+
+	bb.WriteString(" ")
+	bb.WriteString(value)
+	bb.WriteString("\n")
+}
+
+var promLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promMetricName replaces the characters not allowed in the Prometheus names with '_'
+func promMetricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,59 @@
+package gostatok
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusExposition(t *testing.T) {
+	ingest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ingest.Close()
+
+	c := NewClient(Options{APIKey: "1_test", Endpoint: ingest.URL, PrometheusExposition: true})
+
+	ts := time.Now().Unix()
+	c.metricAccumsMx.Lock()
+	c.collectEvent(eventEntry{metricName: "requests", labels: []string{"GET"}, counter: 2, ts: ts, sampleRate: 1})
+	c.collectEvent(eventEntry{metricName: "requests", labels: []string{"GET"}, counter: 3, ts: ts, sampleRate: 1})
+	c.collectEvent(eventEntry{metricName: "latency.ms", labelKeys: []string{"route"}, labels: []string{`/a"b`}, value: 4, ts: ts, sampleRate: 1})
+	c.collectEvent(eventEntry{metricName: "latency.ms", labelKeys: []string{"route"}, labels: []string{`/a"b`}, value: 6, ts: ts, sampleRate: 0.5})
+	c.metricAccumsMx.Unlock()
+
+	bb := &bytes.Buffer{}
+	c.writePrometheus(bb)
+	out := bb.String()
+
+	for _, want := range []string{
+		"# TYPE requests_total counter\nrequests_total{label0=\"GET\"} 5\n",
+		"# TYPE latency_ms summary\n",
+		// The quantiles of the values 4 and 6
+		"latency_ms{route=\"/a\\\"b\",quantile=\"0.5\"} 5\n",
+		"latency_ms{route=\"/a\\\"b\",quantile=\"0.75\"} 5.5\n",
+		"latency_ms{route=\"/a\\\"b\",quantile=\"0.95\"} 5.9\n",
+		"latency_ms{route=\"/a\\\"b\",quantile=\"0.99\"} 5.98\n",
+		"latency_ms_sum{route=\"/a\\\"b\"} 16\n",
+		"latency_ms_count{route=\"/a\\\"b\"} 3\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestPrometheusPercentiles(t *testing.T) {
+	c := newTestClient(t, Options{PrometheusExposition: true, Percentiles: []float32{0.9}})
+
+	c.metricAccumsMx.Lock()
+	c.collectEvent(eventEntry{metricName: "latency", value: 4, ts: time.Now().Unix(), sampleRate: 1})
+	c.metricAccumsMx.Unlock()
+
+	bb := &bytes.Buffer{}
+	c.writePrometheus(bb)
+	if out := bb.String(); !strings.Contains(out, "latency{quantile=\"0.9\"} 4\n") || strings.Contains(out, "quantile=\"0.5\"") {
+		t.Fatalf("unexpected quantiles in:\n%s", out)
+	}
+}
@@ -0,0 +1,142 @@
+package gostatok
+
+import "context"
+
+var registry SyncMap[string, *Client]
+
+// Register makes the client available by name through Use, e.g. to send the metrics of a tenant with its
+// own API key. The client previously registered under the name, if any, is closed in the background,
+// flushing its accumulated events.
+func Register(name string, client *Client) {
+	previous, _ := registry.Swap(name, client)
+	if previous != client {
+		closeReplaced(previous)
+	}
+}
+
+// Unregister removes the client registered under the name and closes it in the background
+func Unregister(name string) {
+	previous, _ := registry.LoadAndDelete(name)
+	closeReplaced(previous)
+}
+
+// Use returns the handle of the client registered under the name. The client is looked up on every event,
+// so the handle may be obtained before Register and follows the replacements. The events of a handle
+// without a registered client are discarded.
+func Use(name string) Handle {
+	return Handle{name}
+}
+
+// Handle is a named client of the registry, see Use
+type Handle struct {
+	name string
+}
+
+var _ Emitter = Handle{}
+
+// Client returns the currently registered client, nil if there is none
+func (h Handle) Client() *Client {
+	c, _ := registry.Load(h.name)
+	return c
+}
+
+func (h Handle) Event(metricName string, value uint32, labels ...string) {
+	if c := h.Client(); c != nil {
+		c.Event(metricName, value, labels...)
+	}
+}
+
+func (h Handle) EventWithError(metricName string, value uint32, labels ...string) error {
+	if c := h.Client(); c != nil {
+		return c.EventWithError(metricName, value, labels...)
+	}
+	return nil
+}
+
+func (h Handle) EventCtx(ctx context.Context, metricName string, value uint32, labels ...string) error {
+	if c := h.Client(); c != nil {
+		return c.EventCtx(ctx, metricName, value, labels...)
+	}
+	return nil
+}
+
+func (h Handle) EventValue(metricName string, value float32, labels ...string) {
+	if c := h.Client(); c != nil {
+		c.EventValue(metricName, value, labels...)
+	}
+}
+
+func (h Handle) EventValueWithError(metricName string, value float32, labels ...string) error {
+	if c := h.Client(); c != nil {
+		return c.EventValueWithError(metricName, value, labels...)
+	}
+	return nil
+}
+
+func (h Handle) EventValueCtx(ctx context.Context, metricName string, value float32, labels ...string) error {
+	if c := h.Client(); c != nil {
+		return c.EventValueCtx(ctx, metricName, value, labels...)
+	}
+	return nil
+}
+
+func (h Handle) EventLabels(metricName string, value uint32, labels Labels) {
+	if c := h.Client(); c != nil {
+		c.EventLabels(metricName, value, labels)
+	}
+}
+
+func (h Handle) EventLabelsWithError(metricName string, value uint32, labels Labels) error {
+	if c := h.Client(); c != nil {
+		return c.EventLabelsWithError(metricName, value, labels)
+	}
+	return nil
+}
+
+func (h Handle) EventLabelsCtx(ctx context.Context, metricName string, value uint32, labels Labels) error {
+	if c := h.Client(); c != nil {
+		return c.EventLabelsCtx(ctx, metricName, value, labels)
+	}
+	return nil
+}
+
+func (h Handle) EventValueLabels(metricName string, value float32, labels Labels) {
+	if c := h.Client(); c != nil {
+		c.EventValueLabels(metricName, value, labels)
+	}
+}
+
+func (h Handle) EventValueLabelsWithError(metricName string, value float32, labels Labels) error {
+	if c := h.Client(); c != nil {
+		return c.EventValueLabelsWithError(metricName, value, labels)
+	}
+	return nil
+}
+
+func (h Handle) EventValueLabelsCtx(ctx context.Context, metricName string, value float32, labels Labels) error {
+	if c := h.Client(); c != nil {
+		return c.EventValueLabelsCtx(ctx, metricName, value, labels)
+	}
+	return nil
+}
+
+func (h Handle) EventBatch(events []BatchEvent) error {
+	if c := h.Client(); c != nil {
+		return c.EventBatch(events)
+	}
+	return nil
+}
+
+func (h Handle) EventBatchCtx(ctx context.Context, events []BatchEvent) error {
+	if c := h.Client(); c != nil {
+		return c.EventBatchCtx(ctx, events)
+	}
+	return nil
+}
+
+func (h Handle) EventBatchPartial(ctx context.Context, events []BatchEvent) (int, error) {
+	if c := h.Client(); c != nil {
+		return c.EventBatchPartial(ctx, events)
+	}
+	return len(events), nil
+}
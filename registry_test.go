@@ -0,0 +1,68 @@
+package gostatok_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+func TestRegistry(t *testing.T) {
+	serverA := statoktest.NewIngestServer("1_a")
+	defer serverA.Close()
+	serverB := statoktest.NewIngestServer("2_b")
+	defer serverB.Close()
+
+	tenantA := gostatok.Use("tenant-a")
+	tenantB := gostatok.Use("tenant-b")
+
+	// Discarded, as nothing is registered yet
+	tenantA.Event("orders", 100)
+
+	gostatok.Register("tenant-a", gostatok.NewClient(gostatok.Options{APIKey: "1_a", Endpoint: serverA.URL()}))
+	gostatok.Register("tenant-b", gostatok.NewClient(gostatok.Options{APIKey: "2_b", Endpoint: serverB.URL()}))
+	defer gostatok.Unregister("tenant-a")
+	defer gostatok.Unregister("tenant-b")
+
+	tenantA.Event("orders", 1)
+	tenantB.Event("orders", 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, h := range []gostatok.Handle{tenantA, tenantB} {
+		if err := h.Client().Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertCounter(t, serverA, "orders", 1)
+	assertCounter(t, serverB, "orders", 2)
+
+	// The replaced client flushes its events on close
+	replaced := tenantA.Client()
+	tenantA.Event("orders", 3)
+	gostatok.Register("tenant-a", gostatok.NewClient(gostatok.Options{APIKey: "1_a", Endpoint: serverA.URL()}))
+	if tenantA.Client() == replaced {
+		t.Fatal("handle didn't follow the replacement")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(serverA.Metrics()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertCounter(t, serverA, "orders", 3)
+	if err := replaced.EventWithError("orders", 1); err != gostatok.ErrClientClosed {
+		t.Fatalf("expected the replaced client to be closed, got %v", err)
+	}
+}
+
+func assertCounter(t *testing.T, server *statoktest.IngestServer, name string, counter uint32) {
+	t.Helper()
+	for _, m := range server.Metrics() {
+		if m.Name == name && m.Accums[0].Counter == counter {
+			return
+		}
+	}
+	t.Fatalf("counter %s=%d was not received: %+v", name, counter, server.Metrics())
+}
@@ -0,0 +1,55 @@
+package gostatok
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// Adaptive sampling starts to kick in when eventsChan is filled above this ratio
+const adaptiveSamplingPressure = 0.5
+
+// Adaptive sampling never keeps less than 1 of adaptiveSamplingMinRate^-1 events
+const adaptiveSamplingMinRate = 0.01
+
+func normalizeSampleRate(rate float64) float32 {
+	if rate <= 0 || rate >= 1 || math.IsNaN(rate) {
+		return 1
+	}
+	return float32(rate)
+}
+
+// sampleRate returns the effective sample rate for the metric, taking the global rate, the per-metric
+// overrides and the current eventsChan pressure into account.
+func (c *Client) sampleRate(metricName string) float32 {
+	rate := c.sampleRateGlobal
+	if r, ok := c.sampleRateByMetric[metricName]; ok {
+		rate = r
+	}
+
+	if c.adaptiveSampling {
+		fill := float32(len(c.eventsChan)) / float32(cap(c.eventsChan))
+		if fill > adaptiveSamplingPressure {
+			rate *= max(adaptiveSamplingMinRate, (1-fill)/(1-adaptiveSamplingPressure))
+		}
+	}
+
+	return rate
+}
+
+// sample decides if an event of the metric should be kept and returns the rate it was sampled with
+func (c *Client) sample(metricName string) (float32, bool) {
+	rate := c.sampleRate(metricName)
+	if rate >= 1 {
+		return 1, true
+	}
+	return rate, rand.Float32() < rate
+}
+
+// scaleBySampleRate extrapolates the sampled counter back to the estimated real counter. The estimate is not
+// rounded, so the sums of many events stay unbiased, the callers round once when the sum is reported.
+func scaleBySampleRate(counter uint32, rate float32) float64 {
+	if rate >= 1 {
+		return float64(counter)
+	}
+	return float64(counter) / float64(rate)
+}
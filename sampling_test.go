@@ -0,0 +1,72 @@
+package gostatok
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestNormalizeSampleRate(t *testing.T) {
+	for rate, expected := range map[float64]float32{0: 1, -1: 1, 1: 1, 2: 1, math.NaN(): 1, 0.25: 0.25} {
+		if got := normalizeSampleRate(rate); got != expected {
+			t.Errorf("normalizeSampleRate(%v) = %v, want %v", rate, got, expected)
+		}
+	}
+}
+
+func TestSampleRateOverrides(t *testing.T) {
+	c := newTestClient(t, Options{SampleRate: 0.5, MetricSampleRates: map[string]float64{"hot": 0.1, "all": 1}})
+
+	for name, expected := range map[string]float32{"other": 0.5, "hot": 0.1, "all": 1} {
+		if got := c.sampleRate(name); got != expected {
+			t.Errorf("sampleRate(%s) = %v, want %v", name, got, expected)
+		}
+	}
+
+	kept := 0
+	for range 10000 {
+		if _, keep := c.sample("hot"); keep {
+			kept++
+		}
+	}
+	if kept < 800 || kept > 1200 {
+		t.Errorf("kept %d of 10000 events at rate 0.1", kept)
+	}
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	c := newTestClient(t, Options{AdaptiveSampling: true, EventsBufferSize: 100})
+
+	if rate := c.sampleRate("m"); rate != 1 {
+		t.Fatalf("sampled without pressure: %v", rate)
+	}
+
+	// Filled to 75%, half way between the pressure threshold and the full queue
+	for range 75 {
+		c.eventsChan <- eventEntry{}
+	}
+	if rate := c.sampleRate("m"); math.Abs(float64(rate)-0.5) > 1e-6 {
+		t.Fatalf("unexpected rate under pressure: %v", rate)
+	}
+
+	for range 25 {
+		c.eventsChan <- eventEntry{}
+	}
+	if rate := c.sampleRate("m"); rate != adaptiveSamplingMinRate {
+		t.Fatalf("unexpected rate of the full queue: %v", rate)
+	}
+}
+
+func TestSampledCountersAreUnbiased(t *testing.T) {
+	for rate, expected := range map[float32]string{0.4: `"c":2500,"r":0.4`, 0.3: `"c":3333,"r":0.3`} {
+		c := newTestClient(t, Options{Codec: CodecNone})
+		for range 1000 {
+			c.collectEvent(eventEntry{metricName: "m", counter: 1, ts: 1_700_000_000, sampleRate: rate})
+		}
+
+		serialized := c.serializeAccums(true).data
+		if !bytes.Contains(serialized.Bytes(), []byte(expected)) {
+			t.Errorf("rate %v: expected %s in %s", rate, expected, serialized.Bytes())
+		}
+	}
+}
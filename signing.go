@@ -0,0 +1,100 @@
+package gostatok
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The headers of the signed requests, see Options.SignRequests
+const (
+	HeaderClientID  = "X-Statok-Client"
+	HeaderTimestamp = "X-Statok-Timestamp"
+	HeaderNonce     = "X-Statok-Nonce"
+	HeaderSignature = "X-Statok-Signature"
+)
+
+// MaxSignatureAge is the max difference between the timestamp of a signed request and the time it's verified at.
+// The API must remember the nonces at least that long to reject the replays.
+const MaxSignatureAge = time.Minute * 5
+
+var (
+	ErrMissingSignature = errors.New("missing signature headers")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpiredSignature = errors.New("signature timestamp is out of the allowed window")
+)
+
+// signedHeaders are the headers covered by the signature besides the timestamp and the nonce,
+// so a captured request can't be re-labelled as another client or encoding
+var signedHeaders = [...]string{HeaderClientID, "Content-Encoding", HeaderFrameEncoding}
+
+// Signature returns the hex encoded HMAC-SHA256 of the request keyed with the secret, the part of the API key
+// after the client id. The signed string is the newline separated method, escaped URL path, client id,
+// Content-Encoding, frame encoding, timestamp and nonce headers, followed by the body:
+//
+//	POST\n/i\n1\nzstd\nidentity\n1700000000\n<nonce>\n<body>
+//
+// The missing headers are signed as empty lines.
+func Signature(secret string, r *http.Request, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, s := range [...]string{r.Method, r.URL.EscapedPath()} {
+		mac.Write([]byte(s))
+		mac.Write([]byte("\n"))
+	}
+	for _, h := range signedHeaders {
+		mac.Write([]byte(r.Header.Get(h)))
+		mac.Write([]byte("\n"))
+	}
+	mac.Write([]byte(r.Header.Get(HeaderTimestamp)))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(r.Header.Get(HeaderNonce)))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature headers of a request against the request and its body, and that
+// its timestamp is within MaxSignatureAge of now. Rejecting the replayed nonces is up to the caller.
+func VerifySignature(r *http.Request, body []byte, secret string, now time.Time) error {
+	timestamp, nonce, signature := r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderNonce), r.Header.Get(HeaderSignature)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return ErrMissingSignature
+	}
+
+	expected := Signature(secret, r, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > MaxSignatureAge || age < -MaxSignatureAge {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+// signRequest replaces the Bearer API key with the signature headers, so a captured request doesn't reveal the secret.
+// The encoding headers must be set before.
+func (c *Client) signRequest(req *http.Request, body []byte) error {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(c.clock.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce[:])
+
+	req.Header.Set(HeaderClientID, strconv.Itoa(c.clientId))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonceHex)
+	req.Header.Set(HeaderSignature, Signature(c.apiSecret, req, body))
+	return nil
+}
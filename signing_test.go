@@ -0,0 +1,171 @@
+package gostatok_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+// capturingClient keeps a copy of the last request to replay it
+type capturingClient struct {
+	mx     sync.Mutex
+	header http.Header
+	body   []byte
+}
+
+func (c *capturingClient) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.mx.Lock()
+	c.header, c.body = req.Header.Clone(), body
+	c.mx.Unlock()
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return http.DefaultClient.Do(req)
+}
+
+// replay sends the captured headers with the body, relabel changes the headers if not nil
+func (c *capturingClient) replay(t *testing.T, url string, body []byte, relabel func(http.Header)) int {
+	t.Helper()
+	c.mx.Lock()
+	req, err := http.NewRequest("POST", url+"/i", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = c.header.Clone()
+	c.mx.Unlock()
+	if relabel != nil {
+		relabel(req.Header)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSignRequests(t *testing.T) {
+	server := statoktest.NewIngestServer("1_secret")
+	defer server.Close()
+	server.RequireSignatures()
+
+	clock := statoktest.NewFakeClock(testStart)
+	server.SetClock(clock)
+
+	httpClient := &capturingClient{}
+	client := gostatok.NewClient(gostatok.Options{
+		APIKey:       "1_secret",
+		Endpoint:     server.URL(),
+		HTTPClient:   httpClient,
+		SignRequests: true,
+		Clock:        clock,
+	})
+	defer client.Close(context.Background())
+
+	client.Event("jobs", 1)
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("signed request was rejected: %v, %v", err, server.Errors())
+	}
+	if len(server.Metrics()) != 1 {
+		t.Fatalf("unexpected metrics: %+v", server.Metrics())
+	}
+	if strings.Contains(httpClient.header.Get("Authorization"), "secret") {
+		t.Fatal("the API key secret was sent with the signed request")
+	}
+
+	if status := httpClient.replay(t, server.URL(), httpClient.body, nil); status != http.StatusUnauthorized {
+		t.Fatalf("replayed request was accepted with status %d", status)
+	}
+	assertLastError(t, server, "replayed nonce")
+
+	// The encoding headers are signed, so the captured request can't be re-labelled
+	relabel := func(h http.Header) {
+		h.Set(gostatok.HeaderFrameEncoding, "snappy")
+		h.Set(gostatok.HeaderNonce, "fresh")
+	}
+	if status := httpClient.replay(t, server.URL(), httpClient.body, relabel); status != http.StatusUnauthorized {
+		t.Fatalf("re-labelled request was accepted with status %d", status)
+	}
+	assertLastError(t, server, gostatok.ErrInvalidSignature.Error())
+
+	tampered := append([]byte(nil), httpClient.body...)
+	tampered[len(tampered)-1] ^= 0xff
+	if status := httpClient.replay(t, server.URL(), tampered, nil); status != http.StatusUnauthorized {
+		t.Fatalf("tampered request was accepted with status %d", status)
+	}
+	assertLastError(t, server, gostatok.ErrInvalidSignature.Error())
+
+	// The signature older than MaxSignatureAge is rejected before its nonce is checked
+	clock.Advance(gostatok.MaxSignatureAge + time.Second)
+	if status := httpClient.replay(t, server.URL(), httpClient.body, nil); status != http.StatusUnauthorized {
+		t.Fatalf("expired request was accepted with status %d", status)
+	}
+	assertLastError(t, server, gostatok.ErrExpiredSignature.Error())
+	if len(server.Metrics()) != 1 {
+		t.Fatalf("rejected requests were accepted: %+v", server.Metrics())
+	}
+}
+
+func TestSignatureCoversRequest(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte("1,jobs,2,[]")
+
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest("POST", "/i", nil)
+		r.Header.Set(gostatok.HeaderClientID, "1")
+		r.Header.Set("Content-Encoding", "gzip")
+		r.Header.Set(gostatok.HeaderFrameEncoding, "identity")
+		r.Header.Set(gostatok.HeaderTimestamp, "1700000000")
+		r.Header.Set(gostatok.HeaderNonce, "nonce")
+		r.Header.Set(gostatok.HeaderSignature, gostatok.Signature("secret", r, body))
+		return r
+	}
+
+	if err := gostatok.VerifySignature(newRequest(), body, "secret", now); err != nil {
+		t.Fatalf("valid signature was rejected: %v", err)
+	}
+
+	for name, relabel := range map[string]func(r *http.Request){
+		"method":           func(r *http.Request) { r.Method = "PUT" },
+		"path":             func(r *http.Request) { r.URL.Path = "/v2/i" },
+		"client id":        func(r *http.Request) { r.Header.Set(gostatok.HeaderClientID, "2") },
+		"content encoding": func(r *http.Request) { r.Header.Del("Content-Encoding") },
+		"frame encoding":   func(r *http.Request) { r.Header.Set(gostatok.HeaderFrameEncoding, "zstd") },
+		"timestamp":        func(r *http.Request) { r.Header.Set(gostatok.HeaderTimestamp, "1700000001") },
+		"nonce":            func(r *http.Request) { r.Header.Set(gostatok.HeaderNonce, "other") },
+	} {
+		r := newRequest()
+		relabel(r)
+		if err := gostatok.VerifySignature(r, body, "secret", now); !errors.Is(err, gostatok.ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+
+	r := newRequest()
+	r.Header.Del(gostatok.HeaderSignature)
+	if err := gostatok.VerifySignature(r, body, "secret", now); !errors.Is(err, gostatok.ErrMissingSignature) {
+		t.Errorf("expected ErrMissingSignature, got %v", err)
+	}
+}
+
+func assertLastError(t *testing.T, server *statoktest.IngestServer, message string) {
+	t.Helper()
+	errs := server.Errors()
+	if len(errs) == 0 || errs[len(errs)-1].Error() != message {
+		t.Fatalf("expected the %q rejection, got %v", message, errs)
+	}
+}
@@ -0,0 +1,196 @@
+package gostatok
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultSpoolMaxBytes = 64 << 20
+
+const spoolFileExt = ".batch"
+
+// spool keeps the batches which could not be delivered in a directory, to resend them later, see Options.SpoolDir.
+// The files are named by the time they were saved and the frame and content encodings of the batch, e.g.
+// "001760000000000000000-000001.zstd.identity.batch", so they are resent with their own encoding.
+type spool struct {
+	dir      string
+	maxBytes int64
+	logger   logger
+
+	mx  sync.Mutex
+	seq uint64
+	// The number of the spooled files, to skip the directory listing when there are none
+	pending int
+}
+
+func newSpool(dir string, maxBytes int64, logger logger) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &spool{
+		dir:      dir,
+		maxBytes: maxBytes,
+		logger:   logger,
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	s.pending = len(files)
+	return s, nil
+}
+
+// save writes the batch as the newest file, then removes the oldest ones above maxBytes
+func (s *spool) save(data []byte, encoding batchEncoding) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	s.seq++
+	name := fmt.Sprintf("%021d-%06d.%s.%s%s", time.Now().UnixNano(), s.seq%1000000,
+		encoding.frame.Encoding(), encoding.content.Encoding(), spoolFileExt)
+	if err = os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	s.pending++
+
+	return s.trim()
+}
+
+// trim removes the oldest files until the spooled bytes fit into maxBytes, s.mx must be held
+func (s *spool) trim() error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	sizes := make([]int64, len(files))
+	for i, name := range files {
+		if info, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; i < len(files) && total > s.maxBytes; i++ {
+		if err = os.Remove(filepath.Join(s.dir, files[i])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= sizes[i]
+		s.pending--
+		s.logger.printf(LogLevelWarn, "statok: spooled batch %s of %d bytes dropped: spool is full", files[i], sizes[i])
+	}
+	return nil
+}
+
+// files returns the names of the spooled batches from the oldest, removing the ones of an unknown encoding.
+// s.mx must be held.
+func (s *spool) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, spoolFileExt) {
+			continue
+		}
+		if _, err = parseSpoolFileEncoding(name); err != nil {
+			_ = os.Remove(filepath.Join(s.dir, name))
+			s.logger.printf(LogLevelWarn, "statok: spooled batch %s dropped: %v", name, err)
+			continue
+		}
+		files = append(files, name)
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// resend sends the spooled batches from the oldest with send, removing the sent ones.
+// It stops at the first error, the rest is kept for the next resend.
+func (s *spool) resend(send func(data *bytes.Buffer, encoding batchEncoding) error) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.pending == 0 {
+		return nil
+	}
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	s.pending = len(files)
+
+	data := bytesBufferPool.Get()
+	defer bytesBufferPool.Put(data)
+	for _, name := range files {
+		path := filepath.Join(s.dir, name)
+		encoding, err := parseSpoolFileEncoding(name)
+		if err != nil {
+			return err
+		}
+
+		data.Reset()
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = data.ReadFrom(f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+
+		if err = send(data, encoding); err != nil {
+			return err
+		}
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.pending--
+	}
+	return nil
+}
+
+// parseSpoolFileEncoding parses the encoding of the batch from the spool file name
+func parseSpoolFileEncoding(name string) (batchEncoding, error) {
+	parts := strings.Split(strings.TrimSuffix(name, spoolFileExt), ".")
+	if len(parts) != 3 {
+		return batchEncoding{}, errors.New("no encoding in the file name")
+	}
+
+	var encoding batchEncoding
+	var err error
+	if encoding.frame, err = ParseCodec(parts[1]); err != nil {
+		return encoding, err
+	}
+	if encoding.content, err = ParseCodec(parts[2]); err != nil {
+		return encoding, err
+	}
+	return encoding, nil
+}
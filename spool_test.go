@@ -0,0 +1,142 @@
+package gostatok_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+func spooledFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.batch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSpool(t *testing.T) {
+	server := statoktest.NewIngestServer("1_test")
+	defer server.Close()
+
+	dir := t.TempDir()
+	options := gostatok.Options{
+		APIKey:     "1_test",
+		Endpoint:   server.URL(),
+		RetryDelay: time.Millisecond,
+		SpoolDir:   dir,
+		LogLevel:   gostatok.LogLevelOff,
+	}
+	client := gostatok.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// All the attempts fail, the batch is kept on disk
+	server.FailNext(3, 503)
+	client.Event("jobs", 1)
+	if err := client.Flush(ctx); err == nil {
+		t.Fatal("expected the send error")
+	}
+	if files := spooledFiles(t, dir); len(files) != 1 {
+		t.Fatalf("expected a spooled batch, got %v", files)
+	}
+
+	// The next successful send resends it
+	client.Event("jobs", 2)
+	if err := client.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if files := spooledFiles(t, dir); len(files) != 0 {
+		t.Fatalf("expected the spooled batch to be resent, got %v", files)
+	}
+	if metrics := server.Metrics(); len(metrics) != 2 || metrics[0].Accums[0].Counter != 2 || metrics[1].Accums[0].Counter != 1 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+
+	// The batches spooled before the restart are resent on the start
+	server.FailNext(3, 503)
+	client.Event("jobs", 3)
+	_ = client.Close(ctx)
+	if files := spooledFiles(t, dir); len(files) != 1 {
+		t.Fatalf("expected a spooled batch, got %v", files)
+	}
+
+	client = gostatok.NewClient(options)
+	defer client.Close(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(server.Metrics()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if metrics := server.Metrics(); len(metrics) != 3 || metrics[2].Accums[0].Counter != 3 {
+		t.Fatalf("unexpected metrics after the restart %+v", metrics)
+	}
+}
+
+func TestSpoolMaxBytes(t *testing.T) {
+	server := statoktest.NewIngestServer("1_test")
+	defer server.Close()
+
+	dir := t.TempDir()
+	// The batches of an unknown encoding are removed on the start
+	if err := os.WriteFile(filepath.Join(dir, "000000000000000000001-000001.lz4.identity.batch"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := gostatok.NewClient(gostatok.Options{
+		APIKey:        "1_test",
+		Endpoint:      server.URL(),
+		RetryDelay:    time.Millisecond,
+		SpoolDir:      dir,
+		SpoolMaxBytes: 1,
+		LogLevel:      gostatok.LogLevelOff,
+	})
+	defer client.Close(context.Background())
+
+	// A batch above SpoolMaxBytes is dropped right away
+	server.FailNext(3, 503)
+	client.Event("jobs", 1)
+	_ = client.Flush(context.Background())
+	if files := spooledFiles(t, dir); len(files) != 0 {
+		t.Fatalf("expected no spooled batches, got %v", files)
+	}
+}
+
+func TestSpoolFanOut(t *testing.T) {
+	prod := statoktest.NewIngestServer("1_test")
+	defer prod.Close()
+	mirror := statoktest.NewIngestServer("1_test")
+	defer mirror.Close()
+
+	dir := t.TempDir()
+	client := gostatok.NewClient(gostatok.Options{
+		APIKey:          "1_test",
+		Destinations:    []string{prod.URL(), mirror.URL()},
+		DestinationMode: gostatok.DestinationFanOut,
+		RetryDelay:      time.Millisecond,
+		SpoolDir:        dir,
+		LogLevel:        gostatok.LogLevelOff,
+	})
+	defer client.Close(context.Background())
+
+	// Only the batch of the failing destination is spooled, in its own subdirectory
+	mirror.FailNext(3, 503)
+	client.Event("jobs", 1)
+	_ = client.Flush(context.Background())
+	if prodFiles, mirrorFiles := spooledFiles(t, filepath.Join(dir, "0")), spooledFiles(t, filepath.Join(dir, "1")); len(prodFiles) != 0 || len(mirrorFiles) != 1 {
+		t.Fatalf("unexpected spooled batches %v %v", prodFiles, mirrorFiles)
+	}
+
+	client.Event("jobs", 2)
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(prod.Metrics()) != 2 || len(mirror.Metrics()) != 2 || len(spooledFiles(t, filepath.Join(dir, "1"))) != 0 {
+		t.Fatalf("the spooled batch wasn't resent: %d prod, %d mirror metrics", len(prod.Metrics()), len(mirror.Metrics()))
+	}
+}
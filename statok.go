@@ -1,17 +1,37 @@
 package gostatok
 
 import (
+	"context"
 	"net/http"
+	"sync/atomic"
+	"time"
 )
 
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-var globalClient *Client
+var globalClient atomic.Pointer[Client]
 
+// replacedClientCloseTimeout limits the flush of the clients replaced by Init and Register
+const replacedClientCloseTimeout = time.Second * 10
+
+// Init makes a new package level client. The previous one, if any, is closed in the background,
+// flushing its accumulated events.
 func Init(options Options) {
-	globalClient = NewClient(options)
+	closeReplaced(globalClient.Swap(NewClient(options)))
+}
+
+// closeReplaced closes the replaced client in the background, so the caller doesn't wait for the flush
+func closeReplaced(c *Client) {
+	if c == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), replacedClientCloseTimeout)
+		defer cancel()
+		_ = c.Close(ctx)
+	}()
 }
 
 func Event[T ~int | ~int8 | ~int16 | ~int32 | ~uint | ~uint8 | ~uint16 | ~uint32](metricName string, value T, labels ...string) {
@@ -19,11 +39,17 @@ func Event[T ~int | ~int8 | ~int16 | ~int32 | ~uint | ~uint8 | ~uint16 | ~uint32
 }
 
 func EventWithError[T ~int | ~int8 | ~int16 | ~int32 | ~uint | ~uint8 | ~uint16 | ~uint32](metricName string, value T, labels ...string) error {
-	if globalClient != nil {
-		return globalClient.EventWithError(metricName, uint32(max(0, value)), labels...)
-	} else {
-		return nil
+	if c := globalClient.Load(); c != nil {
+		return c.EventWithError(metricName, uint32(max(0, value)), labels...)
 	}
+	return nil
+}
+
+func EventCtx[T ~int | ~int8 | ~int16 | ~int32 | ~uint | ~uint8 | ~uint16 | ~uint32](ctx context.Context, metricName string, value T, labels ...string) error {
+	if c := globalClient.Load(); c != nil {
+		return c.EventCtx(ctx, metricName, uint32(max(0, value)), labels...)
+	}
+	return nil
 }
 
 func EventValue[T ~float32 | ~float64](metricName string, value T, labels ...string) {
@@ -31,9 +57,27 @@ func EventValue[T ~float32 | ~float64](metricName string, value T, labels ...str
 }
 
 func EventValueWithError[T ~float32 | ~float64](metricName string, value T, labels ...string) error {
-	if globalClient != nil {
-		return globalClient.EventValueWithError(metricName, float32(value), labels...)
-	} else {
-		return nil
+	if c := globalClient.Load(); c != nil {
+		return c.EventValueWithError(metricName, float32(value), labels...)
+	}
+	return nil
+}
+
+func EventValueCtx[T ~float32 | ~float64](ctx context.Context, metricName string, value T, labels ...string) error {
+	if c := globalClient.Load(); c != nil {
+		return c.EventValueCtx(ctx, metricName, float32(value), labels...)
+	}
+	return nil
+}
+
+func EventLabels[T ~int | ~int8 | ~int16 | ~int32 | ~uint | ~uint8 | ~uint16 | ~uint32](metricName string, value T, labels Labels) {
+	if c := globalClient.Load(); c != nil {
+		c.EventLabels(metricName, uint32(max(0, value)), labels)
+	}
+}
+
+func EventValueLabels[T ~float32 | ~float64](metricName string, value T, labels Labels) {
+	if c := globalClient.Load(); c != nil {
+		c.EventValueLabels(metricName, float32(value), labels)
 	}
 }
@@ -1,20 +1,288 @@
-package gostatok
+package gostatok_test
 
 import (
+	"context"
+	"errors"
 	"math/rand"
+	"net/http"
+	"runtime"
+	"slices"
 	"strconv"
 	"testing"
 	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
 )
 
+// Hour aligned, so every step starts at it
+var testStart = time.Unix(1_700_000_000/3600*3600, 0)
+
 func TestSendEvents(t *testing.T) {
-	Init(Options{APIKey: "Test"})
+	server := statoktest.NewIngestServer("1_test")
+	defer server.Close()
+
+	clock := statoktest.NewFakeClock(testStart)
+	gostatok.Init(gostatok.Options{APIKey: "1_test", Endpoint: server.URL(), RetryDelay: time.Millisecond, Clock: clock})
+	server.FailNext(1, 503)
 
 	for i := 0; i < 99; i++ {
-		//now := time.Now()
-		//math.Ceil(float64(now.Minute())/10)
-		EventValue("test_metric_v"+strconv.Itoa(rand.Intn(2)), rand.NormFloat64(), "aaa_"+strconv.Itoa(rand.Intn(8)), "bbb_2"+strconv.Itoa(rand.Intn(4)))
+		gostatok.EventValue("test_metric_v"+strconv.Itoa(rand.Intn(2)), rand.NormFloat64(), "aaa_"+strconv.Itoa(rand.Intn(8)), "bbb_2"+strconv.Itoa(rand.Intn(4)))
+	}
+	gostatok.Event("test_counter", 5, "x")
+
+	clock.Advance(10 * time.Second)
+	metrics := waitMetric(t, server, clock, "test_counter")
+	accum := metrics[0].Accums[0]
+	if metrics[0].ClientID != 1 || accum.Step != 10 || accum.Counter != 5 || accum.Labels[0] != "x" {
+		t.Fatalf("unexpected metric: %+v", metrics[0])
+	}
+	if server.Requests() < 2 {
+		t.Fatalf("expected a retry after the failure, got %d requests", server.Requests())
+	}
+
+	values := waitMetric(t, server, clock, "test_metric_v0")
+	if len(values[0].Accums[0].Values) != 7 {
+		t.Fatalf("unexpected values: %+v", values[0].Accums[0])
+	}
+}
+
+func TestStepBoundaries(t *testing.T) {
+	server := statoktest.NewIngestServer("1_test")
+	defer server.Close()
+
+	clock := statoktest.NewFakeClock(testStart)
+	client := gostatok.NewClient(gostatok.Options{APIKey: "1_test", Endpoint: server.URL(), Clock: clock})
+
+	client.EventValue("latency", 5)
+	client.Event("hits", 1)
+
+	// Nothing is ready within the first 10 seconds
+	clock.Advance(9 * time.Second)
+	time.Sleep(50 * time.Millisecond)
+	if m := server.Metrics(); len(m) != 0 {
+		t.Fatalf("unexpected metrics before the step boundary: %+v", m)
+	}
+
+	clock.Set(testStart.Add(10 * time.Second))
+	waitMetric(t, server, clock, "latency")
+	assertSteps(t, server, "latency", 10)
+	assertSteps(t, server, "hits", 10)
+
+	clock.Set(testStart.Add(60 * time.Second))
+	waitSteps(t, server, clock, "latency", 10, 60)
+
+	clock.Set(testStart.Add(600 * time.Second))
+	waitSteps(t, server, clock, "latency", 10, 60, 600)
+
+	clock.Set(testStart.Add(3600 * time.Second))
+	waitSteps(t, server, clock, "latency", 10, 60, 600, 3600)
+
+	// Counters are accumulated only for the 10 seconds step
+	assertSteps(t, server, "hits", 10)
+}
+
+func TestFlushAndClose(t *testing.T) {
+	server := statoktest.NewIngestServer("1_test")
+	defer server.Close()
+
+	clock := statoktest.NewFakeClock(testStart)
+	client := gostatok.NewClient(gostatok.Options{APIKey: "1_test", Endpoint: server.URL(), Clock: clock})
+
+	client.Event("jobs", 2, "cron")
+	client.EventValue("duration", 1.5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The current time windows are sent without advancing the clock
+	if err := client.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertSteps(t, server, "jobs", 10)
+	assertSteps(t, server, "duration", 10, 60, 600, 3600)
+
+	client.Event("jobs", 1, "cron")
+	if err := client.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertSteps(t, server, "jobs", 10, 10)
+
+	if err := client.EventWithError("jobs", 1); !errors.Is(err, gostatok.ErrClientClosed) {
+		t.Fatalf("expected ErrClientClosed after Close, got %v", err)
+	}
+	if err := client.Flush(ctx); !errors.Is(err, gostatok.ErrClientClosed) {
+		t.Fatalf("expected ErrClientClosed from Flush after Close, got %v", err)
+	}
+}
+
+func TestSteps(t *testing.T) {
+	server := statoktest.NewIngestServer("1_test")
+	defer server.Close()
+
+	clock := statoktest.NewFakeClock(testStart)
+	client := gostatok.NewClient(gostatok.Options{
+		APIKey:   "1_test",
+		Endpoint: server.URL(),
+		Clock:    clock,
+		Steps:    []gostatok.Step{gostatok.Step600s, gostatok.Step60s},
+	})
+
+	client.Event("jobs", 2, "cron")
+	client.EventValue("duration", 1.5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The counters are accumulated for the shortest step only
+	assertSteps(t, server, "jobs", 60)
+	assertSteps(t, server, "duration", 60, 600)
+}
+
+func TestPercentiles(t *testing.T) {
+	server := statoktest.NewIngestServer("1_test")
+	defer server.Close()
+
+	clock := statoktest.NewFakeClock(testStart)
+	client := gostatok.NewClient(gostatok.Options{
+		APIKey:      "1_test",
+		Endpoint:    server.URL(),
+		Clock:       clock,
+		Steps:       []gostatok.Step{gostatok.Step10s},
+		Percentiles: []float32{0.99, 0.9},
+	})
+
+	for v := 1; v <= 100; v++ {
+		client.EventValue("latency", float32(v))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := server.Metrics()
+	if len(metrics) != 1 {
+		t.Fatalf("got %d metrics", len(metrics))
+	}
+	a := metrics[0].Accums[0]
+	if !slices.Equal(a.Percentiles, []float32{0.9, 0.99}) || len(a.Values) != 5 {
+		t.Fatalf("unexpected accum %+v", a)
+	}
+	if p90, p99 := a.Values[3], a.Values[4]; p90 < 85 || p90 > 95 || p99 < 95 || p99 > 100 {
+		t.Fatalf("unexpected percentile values %v", a.Values)
+	}
+}
+
+// blockingClient holds the requests until released, like an endpoint which is down
+type blockingClient struct {
+	release chan struct{}
+}
+
+func (c blockingClient) Do(req *http.Request) (*http.Response, error) {
+	<-c.release
+	return nil, errors.New("endpoint is down")
+}
+
+func TestCloseWithFullSendQueue(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	clock := statoktest.NewFakeClock(testStart)
+	httpClient := blockingClient{release: make(chan struct{})}
+	client := gostatok.NewClient(gostatok.Options{APIKey: "1_test", HTTPClient: httpClient, RetryDelay: time.Millisecond, Clock: clock})
+
+	// Every step is serialized into a separate batch, until the send queue is full and the serializer waits
+	for i := 0; i < 20; i++ {
+		client.Event("jobs", 1)
+		time.Sleep(5 * time.Millisecond)
+		clock.Advance(10 * time.Second)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the flush to time out, got %v", err)
+	}
+
+	// Only the sender waiting for the endpoint is left, then nothing
+	waitGoroutines(t, goroutines+1)
+	close(httpClient.release)
+	waitGoroutines(t, goroutines)
+}
+
+func waitGoroutines(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left, want %d", runtime.NumGoroutine(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
+}
 
-	time.Sleep(time.Minute * 9999)
+// waitMetric nudges the clock by the flush interval until the metric is received, as the collector may
+// not have processed the events yet when the clock was advanced
+func waitMetric(t *testing.T, server *statoktest.IngestServer, clock *statoktest.FakeClock, name string) []statoktest.IngestMetric {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var found []statoktest.IngestMetric
+		for _, m := range server.Metrics() {
+			if m.Name == name {
+				found = append(found, m)
+			}
+		}
+		if len(found) > 0 {
+			return found
+		}
+		clock.Advance(gostatok.FlushInterval)
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("metric %s was not received, errors: %v", name, server.Errors())
+	return nil
+}
+
+func receivedSteps(server *statoktest.IngestServer, name string) []int {
+	var steps []int
+	for _, m := range server.Metrics() {
+		if m.Name != name {
+			continue
+		}
+		for _, a := range m.Accums {
+			steps = append(steps, a.Step)
+		}
+	}
+	return steps
+}
+
+func waitSteps(t *testing.T, server *statoktest.IngestServer, clock *statoktest.FakeClock, name string, steps ...int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(receivedSteps(server, name)) >= len(steps) {
+			break
+		}
+		clock.Advance(gostatok.FlushInterval)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertSteps(t, server, name, steps...)
+}
+
+func assertSteps(t *testing.T, server *statoktest.IngestServer, name string, steps ...int) {
+	t.Helper()
+	got := receivedSteps(server, name)
+	if len(got) != len(steps) {
+		t.Fatalf("metric %s: received steps %v, want %v", name, got, steps)
+	}
+	for i := range steps {
+		if got[i] != steps[i] {
+			t.Fatalf("metric %s: received steps %v, want %v", name, got, steps)
+		}
+	}
 }
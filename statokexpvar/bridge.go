@@ -0,0 +1,197 @@
+// Package statokexpvar exports the variables published with expvar through a gostatok.Client
+package statokexpvar
+
+import (
+	"context"
+	"expvar"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+const defaultPrefix = "expvar"
+
+type Options struct {
+	// Prefix of the metric names, "expvar" by default. The variable name is appended after '.', with
+	// the characters not allowed in the metric names replaced by '_'.
+	Prefix string
+	// Interval of the export, gostatok.FlushInterval by default
+	Interval time.Duration
+	// Include are path.Match patterns of the variable names to export, all the variables if empty
+	Include []string
+	// Exclude are path.Match patterns of the variable names to skip, applied after Include
+	Exclude []string
+	// Counters are path.Match patterns of the variables reported as counters of the delta since the previous
+	// export, the rest of the variables are reported as gauges. Decreasing counters are treated as reset.
+	Counters []string
+}
+
+// Bridge walks expvar.Do and reports expvar.Int and expvar.Float variables. The expvar.Map keys are flattened
+// into the "key1", "key2", ... labels by the nesting level. The other variable types are skipped.
+// The events rejected by the client validation are counted by "<prefix>.rejected", labelled by the "var" name.
+type Bridge struct {
+	client  gostatok.Emitter
+	options Options
+
+	rejectedMetric string
+
+	mx   sync.Mutex
+	prev map[string]float64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Start creates the bridge and starts exporting every Options.Interval until Stop is called
+func Start(client gostatok.Emitter, options Options) *Bridge {
+	b := New(client, options)
+	go b.run()
+	return b
+}
+
+// New creates the bridge without starting it, call Export manually
+func New(client gostatok.Emitter, options Options) *Bridge {
+	if options.Prefix == "" {
+		options.Prefix = defaultPrefix
+	}
+	if options.Interval <= 0 {
+		options.Interval = gostatok.FlushInterval
+	}
+
+	return &Bridge{
+		client:         client,
+		options:        options,
+		rejectedMetric: options.Prefix + ".rejected",
+		prev:           make(map[string]float64),
+		stop:           make(chan struct{}),
+	}
+}
+
+// Stop stops the export started by Start
+func (b *Bridge) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+	})
+}
+
+func (b *Bridge) run() {
+	ticker := time.NewTicker(b.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.Export()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Export walks the published variables once and reports them. Counters are reported starting from
+// the second export, as there is no delta before.
+func (b *Bridge) Export() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	var batch []gostatok.BatchEvent
+	// The variable names of the batch events, to report the rejected ones
+	var names []string
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !b.isIncluded(kv.Key) {
+			return
+		}
+		isCounter := matchAny(b.options.Counters, kv.Key)
+		metricName := b.options.Prefix + "." + sanitize(kv.Key)
+		batch = b.appendVar(batch, metricName, isCounter, nil, kv.Value)
+		for len(names) < len(batch) {
+			names = append(names, kv.Key)
+		}
+	})
+
+	if len(batch) == 0 {
+		return
+	}
+	rejectedEvents, _ := gostatok.EventBatchBySeries(context.Background(), b.client, batch)
+	rejected := make(map[string]uint32)
+	for _, i := range rejectedEvents {
+		rejected[sanitize(names[i])]++
+	}
+	for name, n := range rejected {
+		b.client.EventLabels(b.rejectedMetric, n, gostatok.L("var", name))
+	}
+}
+
+func (b *Bridge) appendVar(batch []gostatok.BatchEvent, metricName string, isCounter bool, mapKeys []string, v expvar.Var) []gostatok.BatchEvent {
+	var value float64
+	switch v := v.(type) {
+	case *expvar.Int:
+		value = float64(v.Value())
+	case *expvar.Float:
+		value = v.Value()
+	case *expvar.Map:
+		v.Do(func(kv expvar.KeyValue) {
+			batch = b.appendVar(batch, metricName, isCounter, append(mapKeys[:len(mapKeys):len(mapKeys)], kv.Key), kv.Value)
+		})
+		return batch
+	default:
+		return batch
+	}
+
+	labels := make(gostatok.Labels, len(mapKeys))
+	for i, key := range mapKeys {
+		labels[i] = gostatok.Label{Key: "key" + strconv.Itoa(i+1), Value: key}
+	}
+
+	if !isCounter {
+		return append(batch, gostatok.ValueEventLabels(metricName, float32(value), labels))
+	}
+
+	seriesKey := metricName + "\x00" + strings.Join(mapKeys, "\x00")
+	prev, ok := b.prev[seriesKey]
+	if !ok {
+		b.prev[seriesKey] = value
+		return batch
+	}
+	if value < prev {
+		// The counter was reset, it counts from zero
+		prev = 0
+		b.prev[seriesKey] = prev
+	}
+	// The previous value moves only by the reported whole delta, the fraction is kept for the next exports
+	if delta := min(math.Floor(value-prev), math.MaxUint32); delta >= 1 {
+		batch = append(batch, gostatok.CounterEventLabels(metricName, uint32(delta), labels))
+		b.prev[seriesKey] = prev + delta
+	}
+	return batch
+}
+
+func (b *Bridge) isIncluded(name string) bool {
+	if len(b.options.Include) > 0 && !matchAny(b.options.Include, name) {
+		return false
+	}
+	return !matchAny(b.options.Exclude, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == ':' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+}
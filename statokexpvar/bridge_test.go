@@ -0,0 +1,124 @@
+package statokexpvar
+
+import (
+	"expvar"
+	"slices"
+	"strings"
+	"testing"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+// The variables are published once per process, expvar.Publish panics on the duplicates with -count
+var (
+	testGauge    = expvar.NewInt("statokexpvar_test_gauge")
+	testRatio    = expvar.NewFloat("statokexpvar_test/ratio value")
+	testSkipped  = expvar.NewInt("statokexpvar_test_skipped")
+	testMap      = expvar.NewMap("statokexpvar_test_map")
+	testRequests = expvar.NewInt("statokexpvar_test_requests")
+	testHits     = expvar.NewFloat("statokexpvar_test_hits")
+	testBadKeys  = expvar.NewMap("statokexpvar_test_bad_keys")
+)
+
+func TestExportGauges(t *testing.T) {
+	testGauge.Set(7)
+	testRatio.Set(0.25)
+	testSkipped.Set(1)
+	testMap.Init()
+	testMap.Add("a", 1)
+	nested := new(expvar.Map).Init()
+	nested.Add("x", 2)
+	testMap.Set("b", nested)
+	testMap.Set("s", new(expvar.String))
+
+	recorder := statoktest.NewRecorder()
+	New(recorder, Options{
+		Include: []string{"statokexpvar_test_gauge", "statokexpvar_test/*", "statokexpvar_test_skipped", "statokexpvar_test_map"},
+		Exclude: []string{"statokexpvar_test_skipped"},
+	}).Export()
+
+	recorder.AssertValues(t, "expvar.statokexpvar_test_gauge", nil, []float32{7})
+	recorder.AssertValues(t, "expvar.statokexpvar_test_ratio_value", nil, []float32{0.25})
+	recorder.AssertNoEvents(t, "expvar.statokexpvar_test_skipped")
+	recorder.AssertNoEvents(t, "expvar.statokexpvar_test_requests")
+
+	if got := recorder.ValuesLabels("expvar.statokexpvar_test_map", gostatok.L("key1", "a")); !slices.Equal(got, []float32{1}) {
+		t.Fatalf("unexpected map values: %v", got)
+	}
+	if got := recorder.ValuesLabels("expvar.statokexpvar_test_map", gostatok.L("key1", "b", "key2", "x")); !slices.Equal(got, []float32{2}) {
+		t.Fatalf("unexpected nested map values: %v", got)
+	}
+	// The string of the map is skipped
+	if n := len(recorder.Events()); n != 4 {
+		t.Fatalf("expected 4 events, got %d: %+v", n, recorder.Events())
+	}
+}
+
+func TestExportCounters(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+	b := New(recorder, Options{
+		Include:  []string{"statokexpvar_test_requests", "statokexpvar_test_hits"},
+		Counters: []string{"statokexpvar_test_requests", "statokexpvar_test_hits"},
+	})
+
+	export := func(requests int64, hits float64) {
+		testRequests.Set(requests)
+		testHits.Set(hits)
+		b.Export()
+	}
+
+	// There is no delta yet
+	export(10, 1.5)
+	recorder.AssertNoEvents(t, "expvar.statokexpvar_test_requests")
+	recorder.AssertNoEvents(t, "expvar.statokexpvar_test_hits")
+
+	export(15, 3)
+	recorder.AssertCounter(t, "expvar.statokexpvar_test_requests", nil, 5)
+	// The fraction of the float delta is kept for the next export
+	recorder.AssertCounter(t, "expvar.statokexpvar_test_hits", nil, 1)
+	export(15, 3.5)
+	recorder.AssertCounter(t, "expvar.statokexpvar_test_hits", nil, 2)
+
+	// The decreased counter was reset, its value is the delta
+	export(3, 3.5)
+	recorder.AssertCounter(t, "expvar.statokexpvar_test_requests", nil, 8)
+
+	// The increments below 1 add up
+	for _, hits := range []float64{3.9, 4.3, 4.7, 5.1, 5.5} {
+		export(3, hits)
+	}
+	recorder.AssertCounter(t, "expvar.statokexpvar_test_hits", nil, 4)
+	// The reset keeps the fraction below 1 too
+	export(3, 0.5)
+	export(3, 1)
+	recorder.AssertCounter(t, "expvar.statokexpvar_test_hits", nil, 5)
+}
+
+func TestExportRejected(t *testing.T) {
+	testGauge.Set(3)
+	testBadKeys.Init()
+	testBadKeys.Add(`a"b`, 1)
+	testBadKeys.Add("ok", 2)
+
+	// The quoted labels are rejected, like the Client validation does
+	recorder := statoktest.NewRecorder()
+	recorder.Reject(func(e statoktest.Event) error {
+		for i, l := range e.Labels {
+			if strings.Contains(l, `"`) {
+				return &gostatok.ValidationError{Rule: gostatok.RuleLabelChars, MetricName: e.MetricName, LabelIndex: i}
+			}
+		}
+		return nil
+	})
+	New(recorder, Options{
+		Include: []string{"statokexpvar_test_gauge", "statokexpvar_test_bad_keys"},
+	}).Export()
+
+	// The invalid map key doesn't drop the other variables
+	recorder.AssertValues(t, "expvar.statokexpvar_test_gauge", nil, []float32{3})
+	if got := recorder.ValuesLabels("expvar.statokexpvar_test_bad_keys", gostatok.L("key1", "ok")); !slices.Equal(got, []float32{2}) {
+		t.Fatalf("unexpected values: %v", got)
+	}
+	recorder.AssertCounterLabels(t, "expvar.rejected", gostatok.L("var", "statokexpvar_test_bad_keys"), 1)
+}
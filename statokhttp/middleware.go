@@ -0,0 +1,174 @@
+// Package statokhttp records the metrics of net/http servers and clients
+package statokhttp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+const defaultServerPrefix = "http_server"
+
+// Route label of the requests which route is unknown, e.g. not matched by the ServeMux
+const unknownRoute = "unknown"
+
+type MiddlewareOptions struct {
+	// Prefix of the metric names, "http_server" by default:
+	//   <prefix>_requests          counter of the requests
+	//   <prefix>_duration_ms       request latency
+	//   <prefix>_response_bytes    response body size
+	//   <prefix>_in_flight         requests in flight, sampled when a request starts
+	Prefix string
+	// Mux is used to get the route label from the ServeMux pattern matching the request, e.g. "GET /items/{id}"
+	Mux *http.ServeMux
+	// Route extracts the route label from the request, takes precedence over Mux.
+	// It must return a low cardinality value, never the raw path.
+	Route func(r *http.Request) string
+}
+
+// Middleware returns a middleware recording the request count, latency, response size and requests in flight,
+// labelled by the method, the status class and the route
+func Middleware(client gostatok.Emitter, options MiddlewareOptions) func(http.Handler) http.Handler {
+	if options.Prefix == "" {
+		options.Prefix = defaultServerPrefix
+	}
+
+	requestsMetric := options.Prefix + "_requests"
+	durationMetric := options.Prefix + "_duration_ms"
+	responseBytesMetric := options.Prefix + "_response_bytes"
+	inFlightMetric := options.Prefix + "_in_flight"
+
+	var inFlight atomic.Int64
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client.EventValue(inFlightMetric, float32(inFlight.Add(1)))
+			defer inFlight.Add(-1)
+
+			route := options.route(r)
+			start := time.Now()
+
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+
+			duration := time.Since(start)
+			labels := gostatok.L("method", methodLabel(r.Method), "route", route, "status", StatusClass(sw.statusCode()))
+
+			client.EventLabels(requestsMetric, 1, labels)
+			client.EventValueLabels(durationMetric, float32(duration.Seconds()*1000), labels)
+			client.EventValueLabels(responseBytesMetric, float32(sw.written), labels)
+		})
+	}
+}
+
+func (o *MiddlewareOptions) route(r *http.Request) string {
+	var route string
+	if o.Route != nil {
+		route = o.Route(r)
+	} else if o.Mux != nil {
+		_, route = o.Mux.Handler(r)
+	}
+
+	if route == "" {
+		return unknownRoute
+	}
+	return route
+}
+
+// StatusClass returns the status class label, e.g. "2xx" for 204
+func StatusClass(statusCode int) string {
+	if statusCode < 100 || statusCode > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(statusCode/100) + "xx"
+}
+
+// methodLabel limits the method label to the standard methods, the arbitrary methods are sent by clients
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack allows the WebSocket and other protocol upgrades, the hijacked requests are reported with the 1xx status class
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("statokhttp: hijack: %w", http.ErrNotSupported)
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// ReadFrom keeps the sendfile and splice optimizations of io.Copy to the response
+func (w *statusWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		// Hides ReadFrom of the statusWriter itself, so io.Copy doesn't recurse
+		n, err = io.Copy(struct{ io.Writer }{w.ResponseWriter}, r)
+	}
+	w.written += n
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusWriter) statusCode() int {
+	if w.status == 0 {
+		// Nothing was written, net/http responds with 200
+		return http.StatusOK
+	}
+	return w.status
+}
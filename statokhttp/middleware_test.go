@@ -0,0 +1,94 @@
+package statokhttp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("item"))
+	})
+	handler := Middleware(recorder, MiddlewareOptions{Mux: mux})(mux)
+
+	for _, path := range []string{"/items/1", "/items/2", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	ok := gostatok.L("method", "GET", "route", "GET /items/{id}", "status", "2xx")
+	recorder.AssertCounterLabels(t, "http_server_requests", ok, 2)
+	recorder.AssertCounterLabels(t, "http_server_requests", gostatok.L("method", "GET", "route", "unknown", "status", "4xx"), 1)
+	recorder.AssertValueCount(t, "http_server_duration_ms", ok, 2)
+
+	if got := recorder.ValuesLabels("http_server_response_bytes", ok); len(got) != 2 || got[0] != 4 {
+		t.Fatalf("unexpected response sizes: %v", got)
+	}
+	recorder.AssertValues(t, "http_server_in_flight", nil, []float32{1, 1, 1})
+}
+
+func TestMiddlewarePassThroughInterfaces(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		_ = rw.Flush()
+	})
+	mux.HandleFunc("GET /copy", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Error("io.ReaderFrom is not passed through")
+		}
+		_, _ = io.Copy(w, strings.NewReader("copied"))
+	})
+
+	server := httptest.NewServer(Middleware(recorder, MiddlewareOptions{Mux: mux})(mux))
+	defer server.Close()
+
+	for _, path := range []string{"/ws", "/copy"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	// The events are recorded after the handler returns, which may be after the client got the response
+	deadline := time.Now().Add(5 * time.Second)
+	for len(recorder.Events()) < 8 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	recorder.AssertCounterLabels(t, "http_server_requests", gostatok.L("method", "GET", "route", "GET /ws", "status", "1xx"), 1)
+	copied := gostatok.L("method", "GET", "route", "GET /copy", "status", "2xx")
+	if got := recorder.ValuesLabels("http_server_response_bytes", copied); len(got) != 1 || got[0] != 6 {
+		t.Fatalf("unexpected response sizes of io.Copy: %v", got)
+	}
+
+	// Without the underlying io.ReaderFrom
+	rec := httptest.NewRecorder()
+	sw := &statusWriter{ResponseWriter: rec}
+	if n, err := io.Copy(sw, strings.NewReader("abc")); err != nil || n != 3 || sw.written != 3 || rec.Body.String() != "abc" {
+		t.Fatalf("unexpected copy: %d, %v, %q", n, err, rec.Body.String())
+	}
+	if _, _, err := sw.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+}
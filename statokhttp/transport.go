@@ -0,0 +1,188 @@
+package statokhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+const defaultClientPrefix = "http_client"
+
+type TransportOptions struct {
+	// Prefix of the metric names, "http_client" by default:
+	//   <prefix>_requests      counter of the requests, labelled by status class or "error"
+	//   <prefix>_duration_ms   latency until the response headers are received
+	//   <prefix>_errors        counter of the failed requests, labelled by the error kind
+	//   <prefix>_phase_ms      httptrace phase timings (dns, connect, tls, ttfb), only if Trace is set
+	Prefix string
+	// Host extracts the host label, the request URL host by default
+	Host func(r *http.Request) string
+	// WithMethod adds the method label to the requests and duration metrics
+	WithMethod bool
+	// Trace records the httptrace phase timings
+	Trace bool
+	// Exclude skips the matching requests. The requests sent by the gostatok.Client itself are always skipped.
+	Exclude func(r *http.Request) bool
+}
+
+// Transport is an http.RoundTripper recording the metrics of the outbound requests
+type Transport struct {
+	base    http.RoundTripper
+	client  gostatok.Emitter
+	options TransportOptions
+
+	requestsMetric string
+	durationMetric string
+	errorsMetric   string
+	phaseMetric    string
+}
+
+// NewTransport wraps the base RoundTripper, http.DefaultTransport is used if base is nil
+func NewTransport(client gostatok.Emitter, base http.RoundTripper, options TransportOptions) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if options.Prefix == "" {
+		options.Prefix = defaultClientPrefix
+	}
+
+	return &Transport{
+		base:           base,
+		client:         client,
+		options:        options,
+		requestsMetric: options.Prefix + "_requests",
+		durationMetric: options.Prefix + "_duration_ms",
+		errorsMetric:   options.Prefix + "_errors",
+		phaseMetric:    options.Prefix + "_phase_ms",
+	}
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if gostatok.IsIngestRequest(r) || (t.options.Exclude != nil && t.options.Exclude(r)) {
+		return t.base.RoundTrip(r)
+	}
+
+	host := r.URL.Host
+	if t.options.Host != nil {
+		host = t.options.Host(r)
+	}
+
+	var phases *tracePhases
+	if t.options.Trace {
+		phases = &tracePhases{}
+		r = r.WithContext(httptrace.WithClientTrace(r.Context(), phases.clientTrace()))
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(r)
+	duration := time.Since(start)
+
+	status := "error"
+	if err == nil {
+		status = StatusClass(resp.StatusCode)
+	} else {
+		t.client.EventLabels(t.errorsMetric, 1, gostatok.L("host", host, "kind", ErrorKind(err)))
+	}
+
+	labels := gostatok.L("host", host, "status", status)
+	if t.options.WithMethod {
+		labels = append(labels, gostatok.Label{Key: "method", Value: methodLabel(r.Method)})
+	}
+	t.client.EventLabels(t.requestsMetric, 1, labels)
+	t.client.EventValueLabels(t.durationMetric, float32(duration.Seconds()*1000), labels)
+
+	if phases != nil {
+		phases.report(t.client, t.phaseMetric, host, start)
+	}
+
+	return resp, err
+}
+
+// ErrorKind classifies the round trip error: "dns", "tls", "timeout", "dial", "canceled" or "other"
+func ErrorKind(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return "dns"
+	}
+
+	var recordHeaderErr tls.RecordHeaderError
+	var certVerificationErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certInvalidErr x509.CertificateInvalidError
+	if errors.As(err, &recordHeaderErr) || errors.As(err, &certVerificationErr) || errors.As(err, &unknownAuthorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &certInvalidErr) {
+		return "tls"
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return "timeout"
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return "dial"
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+
+	return "other"
+}
+
+// tracePhases collects the httptrace timings, the callbacks may be called from the different goroutines
+type tracePhases struct {
+	mx sync.Mutex
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	firstByte                 time.Time
+}
+
+func (p *tracePhases) set(t *time.Time) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	if t.IsZero() {
+		*t = time.Now()
+	}
+}
+
+func (p *tracePhases) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { p.set(&p.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { p.set(&p.dnsDone) },
+		ConnectStart:         func(string, string) { p.set(&p.connectStart) },
+		ConnectDone:          func(string, string, error) { p.set(&p.connectDone) },
+		TLSHandshakeStart:    func() { p.set(&p.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { p.set(&p.tlsDone) },
+		GotFirstResponseByte: func() { p.set(&p.firstByte) },
+	}
+}
+
+func (p *tracePhases) report(client gostatok.Emitter, metricName string, host string, start time.Time) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	phase := func(name string, from, to time.Time) {
+		if from.IsZero() || to.IsZero() {
+			return
+		}
+		client.EventValueLabels(metricName, float32(to.Sub(from).Seconds()*1000), gostatok.L("host", host, "phase", name))
+	}
+
+	phase("dns", p.dnsStart, p.dnsDone)
+	phase("connect", p.connectStart, p.connectDone)
+	phase("tls", p.tlsStart, p.tlsDone)
+	phase("ttfb", start, p.firstByte)
+}
@@ -0,0 +1,103 @@
+package statokhttp
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&url.Error{Op: "Get", URL: "http://example", Err: &net.DNSError{Err: "no such host", Name: "example"}}, "dns"},
+		{&url.Error{Op: "Get", URL: "https://example", Err: x509.UnknownAuthorityError{}}, "tls"},
+		{fmt.Errorf("wrapped: %w", x509.HostnameError{Host: "example"}), "tls"},
+		{&url.Error{Op: "Get", URL: "http://example", Err: context.DeadlineExceeded}, "timeout"},
+		{&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, "timeout"},
+		{&url.Error{Op: "Get", URL: "http://example", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}, "dial"},
+		{&url.Error{Op: "Get", URL: "http://example", Err: context.Canceled}, "canceled"},
+		{errors.New("unexpected EOF"), "other"},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorKind(tt.err); got != tt.want {
+			t.Errorf("ErrorKind(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	recorder := statoktest.NewRecorder()
+	client := &http.Client{Transport: NewTransport(recorder, nil, TransportOptions{Trace: true, WithMethod: true})}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	host := server.Listener.Addr().String()
+	ok := gostatok.L("host", host, "status", "2xx", "method", "GET")
+	recorder.AssertCounterLabels(t, "http_client_requests", ok, 1)
+	recorder.AssertValueCount(t, "http_client_duration_ms", ok, 1)
+	recorder.AssertValueCount(t, "http_client_phase_ms", gostatok.L("host", host, "phase", "connect"), 1)
+	recorder.AssertValueCount(t, "http_client_phase_ms", gostatok.L("host", host, "phase", "ttfb"), 1)
+	// Neither DNS nor TLS are used for the plain IP address
+	recorder.AssertValueCount(t, "http_client_phase_ms", gostatok.L("host", host, "phase", "dns"), 0)
+	recorder.AssertValueCount(t, "http_client_phase_ms", gostatok.L("host", host, "phase", "tls"), 0)
+	recorder.AssertNoEvents(t, "http_client_errors")
+
+	// The closed server refuses the connections
+	server.Close()
+	if _, err := client.Get(server.URL); err == nil {
+		t.Fatal("expected an error")
+	}
+	recorder.AssertCounterLabels(t, "http_client_requests", gostatok.L("host", host, "status", "error", "method", "GET"), 1)
+	recorder.AssertCounterLabels(t, "http_client_errors", gostatok.L("host", host, "kind", "dial"), 1)
+}
+
+func TestTransportSkipsIngestRequests(t *testing.T) {
+	server := statoktest.NewIngestServer("1_test")
+	defer server.Close()
+
+	recorder := statoktest.NewRecorder()
+	client := gostatok.NewClient(gostatok.Options{
+		APIKey:     "1_test",
+		Endpoint:   server.URL(),
+		HTTPClient: &http.Client{Transport: NewTransport(recorder, nil, TransportOptions{})},
+	})
+	defer client.Close(context.Background())
+
+	client.Event("jobs", 1)
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("%v, server errors: %v", err, server.Errors())
+	}
+
+	if server.Requests() == 0 {
+		t.Fatal("no ingest requests were sent")
+	}
+	recorder.AssertNoEvents(t, "http_client_requests")
+	recorder.AssertNoEvents(t, "http_client_duration_ms")
+}
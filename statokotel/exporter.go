@@ -0,0 +1,346 @@
+// Package statokotel adapts the OpenTelemetry metrics SDK to send the data through a gostatok.Client
+package statokotel
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/approx"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+const defaultMaxHistogramSamples = 256
+
+const rejectedMetric = "otel.rejected"
+
+type Options struct {
+	// MaxHistogramSamples limits the values sent per histogram data point per export, 256 by default.
+	// The bucket midpoints are sampled with approx.HistogramSamples, the "<name>.count" counter has the exact count.
+	MaxHistogramSamples int
+}
+
+// Exporter implements sdkmetric.Exporter, converting the data points to statok events:
+//   - monotonic Sum to counters of the delta
+//   - non-monotonic Sum and Gauge to values
+//   - Histogram and ExponentialHistogram to values distributed like the bucket deltas
+//
+// The attributes become named labels. Delta temporality is requested for everything except
+// the up-down counters, the cumulative data points are converted to deltas anyway.
+// The events rejected by the client validation are counted by "otel.rejected", labelled by the "metric" name.
+type Exporter struct {
+	client  gostatok.Emitter
+	options Options
+
+	mx       sync.Mutex
+	shutdown bool
+	prev     map[seriesKey]*seriesState
+}
+
+type seriesKey struct {
+	name  string
+	attrs attribute.Distinct
+}
+
+// seriesState is the state of a series kept between the exports, for the delta conversion
+type seriesState struct {
+	sum float64
+	// fraction is the growth of the monotonic sum below 1 which isn't reported yet
+	fraction float64
+
+	counts         []uint64
+	negativeCounts []uint64
+	zeroCount      uint64
+	offset         int32
+	negativeOffset int32
+	scale          int32
+}
+
+var _ sdkmetric.Exporter = (*Exporter)(nil)
+
+func NewExporter(client gostatok.Emitter, options Options) *Exporter {
+	if options.MaxHistogramSamples <= 0 {
+		options.MaxHistogramSamples = defaultMaxHistogramSamples
+	}
+	return &Exporter{
+		client:  client,
+		options: options,
+		prev:    make(map[seriesKey]*seriesState),
+	}
+}
+
+func (e *Exporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	switch kind {
+	case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+		// Reported as gauges, so the current value is needed
+		return metricdata.CumulativeTemporality
+	default:
+		return metricdata.DeltaTemporality
+	}
+}
+
+func (e *Exporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+func (e *Exporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	if e.shutdown {
+		return sdkmetric.ErrExporterShutdown
+	}
+
+	var batch []gostatok.BatchEvent
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			name := metricName(m.Name)
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				batch = appendSum(e, batch, name, data)
+			case metricdata.Sum[float64]:
+				batch = appendSum(e, batch, name, data)
+			case metricdata.Gauge[int64]:
+				batch = appendGauge(batch, name, data)
+			case metricdata.Gauge[float64]:
+				batch = appendGauge(batch, name, data)
+			case metricdata.Histogram[int64]:
+				batch = appendHistogram(e, batch, name, data)
+			case metricdata.Histogram[float64]:
+				batch = appendHistogram(e, batch, name, data)
+			case metricdata.ExponentialHistogram[int64]:
+				batch = appendExponentialHistogram(e, batch, name, data)
+			case metricdata.ExponentialHistogram[float64]:
+				batch = appendExponentialHistogram(e, batch, name, data)
+			}
+		}
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+	rejectedEvents, err := gostatok.EventBatchBySeries(ctx, e.client, batch)
+	rejected := make(map[string]uint32)
+	for _, i := range rejectedEvents {
+		rejected[batch[i].MetricName]++
+	}
+	for name, n := range rejected {
+		e.client.EventLabels(rejectedMetric, n, gostatok.L("metric", name))
+	}
+	return err
+}
+
+// ForceFlush is a no-op, the data is handed over to the Client on Export
+func (e *Exporter) ForceFlush(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	e.shutdown = true
+	return ctx.Err()
+}
+
+func (e *Exporter) state(name string, attrs attribute.Set) (*seriesState, bool) {
+	key := seriesKey{name, attrs.Equivalent()}
+	s, ok := e.prev[key]
+	if !ok {
+		s = &seriesState{}
+		e.prev[key] = s
+	}
+	return s, ok
+}
+
+func appendSum[N int64 | float64](e *Exporter, batch []gostatok.BatchEvent, name string, data metricdata.Sum[N]) []gostatok.BatchEvent {
+	for _, dp := range data.DataPoints {
+		labels := attributesToLabels(dp.Attributes)
+		value := float64(dp.Value)
+
+		if !data.IsMonotonic {
+			if data.Temporality == metricdata.DeltaTemporality {
+				s, _ := e.state(name, dp.Attributes)
+				s.sum += value
+				value = s.sum
+			}
+			batch = append(batch, gostatok.ValueEventLabels(name, float32(value), labels))
+			continue
+		}
+
+		s, ok := e.state(name, dp.Attributes)
+		if data.Temporality == metricdata.CumulativeTemporality {
+			prev := s.sum
+			s.sum = value
+			if !ok {
+				continue
+			}
+			if value >= prev {
+				value -= prev
+			}
+		}
+
+		// The fraction is kept for the next exports
+		value += s.fraction
+		delta := min(math.Floor(value), math.MaxUint32)
+		s.fraction = value - delta
+		if delta >= 1 {
+			batch = append(batch, gostatok.CounterEventLabels(name, uint32(delta), labels))
+		}
+	}
+	return batch
+}
+
+func appendGauge[N int64 | float64](batch []gostatok.BatchEvent, name string, data metricdata.Gauge[N]) []gostatok.BatchEvent {
+	for _, dp := range data.DataPoints {
+		batch = append(batch, gostatok.ValueEventLabels(name, float32(dp.Value), attributesToLabels(dp.Attributes)))
+	}
+	return batch
+}
+
+func appendHistogram[N int64 | float64](e *Exporter, batch []gostatok.BatchEvent, name string, data metricdata.Histogram[N]) []gostatok.BatchEvent {
+	for _, dp := range data.DataPoints {
+		counts := dp.BucketCounts
+		if data.Temporality == metricdata.CumulativeTemporality {
+			s, ok := e.state(name, dp.Attributes)
+			prev := s.counts
+			s.counts = slices.Clone(dp.BucketCounts)
+			if !ok {
+				continue
+			}
+			counts = deltaCounts(dp.BucketCounts, prev)
+		}
+
+		lowest, highest := math.Inf(-1), math.Inf(1)
+		if v, ok := dp.Min.Value(); ok {
+			lowest = float64(v)
+		}
+		if v, ok := dp.Max.Value(); ok {
+			highest = float64(v)
+		}
+
+		batch = e.appendBuckets(batch, name, attributesToLabels(dp.Attributes), counts, func(i int) float64 {
+			lower, upper := lowest, highest
+			if i > 0 {
+				lower = dp.Bounds[i-1]
+			}
+			if i < len(dp.Bounds) {
+				upper = dp.Bounds[i]
+			}
+			return approx.BucketMidpoint(lower, upper)
+		})
+	}
+	return batch
+}
+
+func appendExponentialHistogram[N int64 | float64](e *Exporter, batch []gostatok.BatchEvent, name string, data metricdata.ExponentialHistogram[N]) []gostatok.BatchEvent {
+	for _, dp := range data.DataPoints {
+		positive, negative, zero := dp.PositiveBucket.Counts, dp.NegativeBucket.Counts, dp.ZeroCount
+
+		if data.Temporality == metricdata.CumulativeTemporality {
+			s, ok := e.state(name, dp.Attributes)
+			prev := *s
+			s.counts = slices.Clone(dp.PositiveBucket.Counts)
+			s.negativeCounts = slices.Clone(dp.NegativeBucket.Counts)
+			s.zeroCount = dp.ZeroCount
+			s.offset, s.negativeOffset, s.scale = dp.PositiveBucket.Offset, dp.NegativeBucket.Offset, dp.Scale
+			if !ok {
+				continue
+			}
+			if prev.scale == dp.Scale && prev.offset == dp.PositiveBucket.Offset && prev.negativeOffset == dp.NegativeBucket.Offset {
+				positive = deltaCounts(positive, prev.counts)
+				negative = deltaCounts(negative, prev.negativeCounts)
+				if zero >= prev.zeroCount {
+					zero -= prev.zeroCount
+				}
+			}
+		}
+
+		base := math.Exp2(math.Exp2(-float64(dp.Scale)))
+		bucketValue := func(offset int32, sign float64) func(int) float64 {
+			return func(i int) float64 {
+				index := float64(offset) + float64(i)
+				return sign * approx.BucketMidpoint(math.Pow(base, index), math.Pow(base, index+1))
+			}
+		}
+
+		// The zero bucket is appended as the last one
+		counts := append(slices.Clone(positive), negative...)
+		counts = append(counts, zero)
+
+		batch = e.appendBuckets(batch, name, attributesToLabels(dp.Attributes), counts, func(i int) float64 {
+			switch {
+			case i < len(positive):
+				return bucketValue(dp.PositiveBucket.Offset, 1)(i)
+			case i < len(positive)+len(negative):
+				return bucketValue(dp.NegativeBucket.Offset, -1)(i - len(positive))
+			default:
+				return 0
+			}
+		})
+	}
+	return batch
+}
+
+// appendBuckets appends the exact count and the bucket values as allocated by approx.HistogramSamples
+func (e *Exporter) appendBuckets(batch []gostatok.BatchEvent, name string, labels gostatok.Labels, counts []uint64, bucketValue func(i int) float64) []gostatok.BatchEvent {
+	var total uint64
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return batch
+	}
+
+	batch = append(batch, gostatok.CounterEventLabels(name+".count", uint32(min(total, math.MaxUint32)), labels))
+
+	for i, n := range approx.HistogramSamples(counts, e.options.MaxHistogramSamples) {
+		value := float32(bucketValue(i))
+		for range n {
+			batch = append(batch, gostatok.ValueEventLabels(name, value, labels))
+		}
+	}
+	return batch
+}
+
+// deltaCounts returns the bucket deltas, or the current counts if the histogram was reset
+func deltaCounts(current, prev []uint64) []uint64 {
+	if len(current) != len(prev) {
+		return current
+	}
+	delta := make([]uint64, len(current))
+	for i := range current {
+		if current[i] < prev[i] {
+			return current
+		}
+		delta[i] = current[i] - prev[i]
+	}
+	return delta
+}
+
+func attributesToLabels(attrs attribute.Set) gostatok.Labels {
+	if attrs.Len() == 0 {
+		return nil
+	}
+	labels := make(gostatok.Labels, 0, attrs.Len())
+	iter := attrs.Iter()
+	for iter.Next() {
+		kv := iter.Attribute()
+		labels = append(labels, gostatok.Label{Key: metricName(string(kv.Key)), Value: kv.Value.Emit()})
+	}
+	return labels
+}
+
+// metricName replaces the characters not allowed in the metric names with '_'
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == ':' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,174 @@
+package statokotel
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func export(t *testing.T, e *Exporter, metrics ...metricdata.Metrics) {
+	t.Helper()
+	rm := &metricdata.ResourceMetrics{ScopeMetrics: []metricdata.ScopeMetrics{{Metrics: metrics}}}
+	if err := e.Export(context.Background(), rm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportSums(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+	e := NewExporter(recorder, Options{})
+	attrs := attribute.NewSet(attribute.String("http.route", "/items"))
+
+	cumulative := func(v int64) metricdata.Metrics {
+		return metricdata.Metrics{Name: "requests total", Data: metricdata.Sum[int64]{
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+			DataPoints:  []metricdata.DataPoint[int64]{{Attributes: attrs, Value: v}},
+		}}
+	}
+	upDown := func(v float64) metricdata.Metrics {
+		return metricdata.Metrics{Name: "queue", Data: metricdata.Sum[float64]{
+			Temporality: metricdata.DeltaTemporality,
+			DataPoints:  []metricdata.DataPoint[float64]{{Value: v}},
+		}}
+	}
+
+	// The first cumulative data point is remembered only
+	export(t, e, cumulative(10), upDown(3))
+	export(t, e, cumulative(14), upDown(-1))
+	export(t, e, metricdata.Metrics{Name: "temperature", Data: metricdata.Gauge[float64]{
+		DataPoints: []metricdata.DataPoint[float64]{{Value: 21.5}},
+	}})
+
+	recorder.AssertCounterLabels(t, "requests_total", gostatok.L("http.route", "/items"), 4)
+	// The deltas of the up-down counters are summed up to the current value
+	recorder.AssertValues(t, "queue", nil, []float32{3, 2})
+	recorder.AssertValues(t, "temperature", nil, []float32{21.5})
+}
+
+func TestExportFractionalSums(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+	e := NewExporter(recorder, Options{})
+
+	sum := func(name string, temporality metricdata.Temporality, v float64) metricdata.Metrics {
+		return metricdata.Metrics{Name: name, Data: metricdata.Sum[float64]{
+			Temporality: temporality,
+			IsMonotonic: true,
+			DataPoints:  []metricdata.DataPoint[float64]{{Value: v}},
+		}}
+	}
+
+	// The growth below 1 per export is carried over instead of rounded away or up
+	for i := 1; i <= 8; i++ {
+		export(t, e,
+			sum("slow", metricdata.DeltaTemporality, 0.25),
+			sum("fast", metricdata.DeltaTemporality, 0.75),
+			sum("cumulative", metricdata.CumulativeTemporality, 0.5*float64(i)),
+		)
+	}
+	recorder.AssertCounter(t, "slow", nil, 2)
+	recorder.AssertCounter(t, "fast", nil, 6)
+	// The first cumulative data point is remembered only
+	recorder.AssertCounter(t, "cumulative", nil, 3)
+}
+
+func TestExportHistogram(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+	e := NewExporter(recorder, Options{MaxHistogramSamples: 10})
+
+	export(t, e, metricdata.Metrics{Name: "latency", Data: metricdata.Histogram[float64]{
+		Temporality: metricdata.DeltaTemporality,
+		DataPoints: []metricdata.HistogramDataPoint[float64]{{
+			Bounds:       []float64{1, 2, 3},
+			BucketCounts: []uint64{0, 1000, 3, 1},
+			Count:        1004,
+			Min:          metricdata.NewExtrema(0.5),
+			Max:          metricdata.NewExtrema(5.0),
+		}},
+	}})
+
+	recorder.AssertCounter(t, "latency.count", nil, 1004)
+	// The sparse tail buckets don't get a sample of their own, so the total stays within MaxHistogramSamples
+	values := recorder.Values("latency")
+	if len(values) != 10 {
+		t.Fatalf("expected 10 samples, got %v", values)
+	}
+	for _, v := range values {
+		if v != 1.5 {
+			t.Fatalf("unexpected sample %v", v)
+		}
+	}
+}
+
+func TestExportExponentialHistogram(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+	e := NewExporter(recorder, Options{})
+
+	point := func(positive uint64) metricdata.Metrics {
+		return metricdata.Metrics{Name: "size", Data: metricdata.ExponentialHistogram[int64]{
+			Temporality: metricdata.CumulativeTemporality,
+			DataPoints: []metricdata.ExponentialHistogramDataPoint[int64]{{
+				// The base is 2, the bucket 0 is (1, 2]
+				Scale:          0,
+				ZeroCount:      1,
+				PositiveBucket: metricdata.ExponentialBucket{Offset: 0, Counts: []uint64{positive}},
+				NegativeBucket: metricdata.ExponentialBucket{Offset: 1, Counts: []uint64{1}},
+			}},
+		}}
+	}
+
+	export(t, e, point(1))
+	recorder.AssertNoEvents(t, "size")
+
+	export(t, e, point(3))
+	recorder.AssertCounter(t, "size.count", nil, 2)
+	recorder.AssertValues(t, "size", nil, []float32{1.5, 1.5})
+}
+
+func TestExportRejected(t *testing.T) {
+	// The quoted labels are rejected, like the Client validation does
+	recorder := statoktest.NewRecorder()
+	recorder.Reject(func(e statoktest.Event) error {
+		for i, l := range e.Labels {
+			if strings.Contains(l, `"`) {
+				return &gostatok.ValidationError{Rule: gostatok.RuleLabelChars, MetricName: e.MetricName, LabelIndex: i}
+			}
+		}
+		return nil
+	})
+	e := NewExporter(recorder, Options{})
+
+	export(t, e, metricdata.Metrics{Name: "requests", Data: metricdata.Sum[int64]{
+		Temporality: metricdata.DeltaTemporality,
+		IsMonotonic: true,
+		DataPoints: []metricdata.DataPoint[int64]{
+			{Attributes: attribute.NewSet(attribute.String("path", "/items")), Value: 3},
+			{Attributes: attribute.NewSet(attribute.String("path", `/"quoted"`)), Value: 2},
+		},
+	}}, metricdata.Metrics{Name: "temperature", Data: metricdata.Gauge[float64]{
+		DataPoints: []metricdata.DataPoint[float64]{{Value: 21.5}},
+	}})
+
+	// The invalid data point doesn't drop the rest of the export
+	recorder.AssertCounterLabels(t, "requests", gostatok.L("path", "/items"), 3)
+	recorder.AssertValues(t, "temperature", nil, []float32{21.5})
+	recorder.AssertCounterLabels(t, "otel.rejected", gostatok.L("metric", "requests"), 1)
+}
+
+func TestExportAfterShutdown(t *testing.T) {
+	e := NewExporter(statoktest.NewRecorder(), Options{})
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	err := e.Export(context.Background(), &metricdata.ResourceMetrics{})
+	if !errors.Is(err, sdkmetric.ErrExporterShutdown) {
+		t.Fatalf("expected ErrExporterShutdown, got %v", err)
+	}
+}
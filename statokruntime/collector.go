@@ -0,0 +1,238 @@
+// Package statokruntime periodically reports the Go runtime metrics through a gostatok.Client
+package statokruntime
+
+import (
+	"context"
+	"math"
+	"runtime/metrics"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/approx"
+)
+
+const defaultPrefix = "go"
+const defaultMaxHistogramSamples = 256
+
+// DefaultMetrics are the runtime/metrics names exported when Options.Filter is not set
+var DefaultMetrics = []string{
+	"/gc/pauses:seconds",
+	"/gc/cycles/total:gc-cycles",
+	"/gc/heap/allocs:bytes",
+	"/memory/classes/heap/objects:bytes",
+	"/memory/classes/total:bytes",
+	"/sched/goroutines:goroutines",
+	"/sched/latencies:seconds",
+	"/sync/mutex/wait/total:seconds",
+}
+
+type Options struct {
+	// Prefix of the metric names, "go" by default. The runtime metric name is appended with '/' replaced
+	// by '.' and the unit after ':' replaced by '_' + unit, e.g. "/sched/goroutines:goroutines" is reported as
+	// "go.sched.goroutines_goroutines". The seconds are converted to microseconds with the "_us" unit.
+	Prefix string
+	// Interval of the collection, gostatok.FlushInterval by default
+	Interval time.Duration
+	// Filter selects the runtime/metrics names to export, DefaultMetrics are exported if nil
+	Filter func(name string) bool
+	// MaxHistogramSamples limits the values sent per histogram metric per collection, 256 by default.
+	// The bucket midpoints are sent as allocated by approx.HistogramSamples, the exact count of the observations
+	// is reported by the "<name>.count" counter.
+	MaxHistogramSamples int
+}
+
+// Collector reads runtime/metrics and reports them:
+//   - the cumulative metrics as counters of the delta since the previous collection, or values of the delta
+//     for the float ones
+//   - the gauge metrics as values
+//   - the histograms as values distributed like the bucket deltas since the previous collection
+//
+// The events rejected by the client validation are counted by "<prefix>.rejected", labelled by the "metric" name.
+type Collector struct {
+	client         gostatok.Emitter
+	options        Options
+	rejectedMetric string
+
+	samples    []metrics.Sample
+	names      []string
+	units      []float64
+	cumulative []bool
+
+	mx         sync.Mutex
+	prevUint   map[string]uint64
+	prevFloat  map[string]float64
+	prevCounts map[string][]uint64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Start creates the collector and starts collecting every Options.Interval until Stop is called
+func Start(client gostatok.Emitter, options Options) *Collector {
+	c := New(client, options)
+	go c.run()
+	return c
+}
+
+// New creates the collector without starting it, call Collect manually
+func New(client gostatok.Emitter, options Options) *Collector {
+	if options.Prefix == "" {
+		options.Prefix = defaultPrefix
+	}
+	if options.Interval <= 0 {
+		options.Interval = gostatok.FlushInterval
+	}
+	if options.MaxHistogramSamples <= 0 {
+		options.MaxHistogramSamples = defaultMaxHistogramSamples
+	}
+	if options.Filter == nil {
+		options.Filter = func(name string) bool {
+			return slices.Contains(DefaultMetrics, name)
+		}
+	}
+
+	c := &Collector{
+		client:         client,
+		options:        options,
+		rejectedMetric: options.Prefix + ".rejected",
+		prevUint:       make(map[string]uint64),
+		prevFloat:      make(map[string]float64),
+		prevCounts:     make(map[string][]uint64),
+		stop:           make(chan struct{}),
+	}
+
+	for _, d := range metrics.All() {
+		if d.Kind == metrics.KindBad || !options.Filter(d.Name) {
+			continue
+		}
+		name, unit := metricName(options.Prefix, d.Name)
+		c.samples = append(c.samples, metrics.Sample{Name: d.Name})
+		c.names = append(c.names, name)
+		c.units = append(c.units, unit)
+		c.cumulative = append(c.cumulative, d.Cumulative)
+	}
+
+	return c
+}
+
+// Stop stops the collection started by Start
+func (c *Collector) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+func (c *Collector) run() {
+	ticker := time.NewTicker(c.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Collect()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Collect reads the runtime metrics once and reports them. The first collection only remembers
+// the cumulative metrics, as there is no delta yet.
+func (c *Collector) Collect() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	metrics.Read(c.samples)
+
+	var batch []gostatok.BatchEvent
+	for i, s := range c.samples {
+		name, unit := c.names[i], c.units[i]
+
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			v := s.Value.Uint64()
+			if !c.cumulative[i] {
+				batch = append(batch, gostatok.ValueEvent(name, float32(float64(v)*unit)))
+				continue
+			}
+			prev, ok := c.prevUint[s.Name]
+			c.prevUint[s.Name] = v
+			if ok && v > prev {
+				batch = append(batch, gostatok.CounterEvent(name, uint32(min(v-prev, math.MaxUint32))))
+			}
+		case metrics.KindFloat64:
+			v := s.Value.Float64()
+			if !c.cumulative[i] {
+				batch = append(batch, gostatok.ValueEvent(name, float32(v*unit)))
+				continue
+			}
+			prev, ok := c.prevFloat[s.Name]
+			c.prevFloat[s.Name] = v
+			if ok && v > prev {
+				batch = append(batch, gostatok.ValueEvent(name, float32((v-prev)*unit)))
+			}
+		case metrics.KindFloat64Histogram:
+			batch = c.appendHistogram(batch, s.Name, name, unit, s.Value.Float64Histogram())
+		}
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+	rejectedEvents, _ := gostatok.EventBatchBySeries(context.Background(), c.client, batch)
+	rejected := make(map[string]uint32)
+	for _, i := range rejectedEvents {
+		rejected[batch[i].MetricName]++
+	}
+	for name, n := range rejected {
+		c.client.EventLabels(c.rejectedMetric, n, gostatok.L("metric", name))
+	}
+}
+
+func (c *Collector) appendHistogram(batch []gostatok.BatchEvent, runtimeName, name string, unit float64, h *metrics.Float64Histogram) []gostatok.BatchEvent {
+	prev, ok := c.prevCounts[runtimeName]
+	if !ok || len(prev) != len(h.Counts) {
+		c.prevCounts[runtimeName] = slices.Clone(h.Counts)
+		return batch
+	}
+
+	deltas := make([]uint64, len(h.Counts))
+	var total uint64
+	for i, count := range h.Counts {
+		deltas[i] = count - prev[i]
+		total += deltas[i]
+	}
+	if total == 0 {
+		return batch
+	}
+
+	batch = append(batch, gostatok.CounterEvent(name+".count", uint32(min(total, math.MaxUint32))))
+
+	samples := approx.HistogramSamples(deltas, c.options.MaxHistogramSamples)
+	for i, n := range samples {
+		value := float32(approx.BucketMidpoint(h.Buckets[i], h.Buckets[i+1]) * unit)
+		for range n {
+			batch = append(batch, gostatok.ValueEvent(name, value))
+		}
+	}
+
+	copy(prev, h.Counts)
+	return batch
+}
+
+// metricName converts the runtime metric name to the statok metric name and the multiplier of the values
+func metricName(prefix, runtimeName string) (string, float64) {
+	name, unit, _ := strings.Cut(runtimeName, ":")
+
+	multiplier := 1.0
+	if unit == "seconds" {
+		unit = "us"
+		multiplier = 1e6
+	}
+
+	name = strings.ReplaceAll(strings.Trim(name, "/"), "/", ".")
+	return prefix + "." + name + "_" + unit, multiplier
+}
@@ -0,0 +1,107 @@
+package statokruntime
+
+import (
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+func TestMetricName(t *testing.T) {
+	for _, tt := range []struct {
+		runtimeName string
+		want        string
+		multiplier  float64
+	}{
+		{"/sched/goroutines:goroutines", "go.sched.goroutines_goroutines", 1},
+		{"/gc/pauses:seconds", "go.gc.pauses_us", 1e6},
+		{"/memory/classes/total:bytes", "go.memory.classes.total_bytes", 1},
+	} {
+		name, multiplier := metricName("go", tt.runtimeName)
+		if name != tt.want || multiplier != tt.multiplier {
+			t.Errorf("metricName(%q) = %q, %v, want %q, %v", tt.runtimeName, name, multiplier, tt.want, tt.multiplier)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+	c := New(recorder, Options{Filter: func(name string) bool {
+		return name == "/gc/cycles/total:gc-cycles" || name == "/sched/goroutines:goroutines"
+	}})
+
+	// The first collection only remembers the cumulative metrics
+	c.Collect()
+	recorder.AssertNoEvents(t, "go.gc.cycles.total_gc-cycles")
+
+	runtime.GC()
+	c.Collect()
+
+	if got := recorder.Counter("go.gc.cycles.total_gc-cycles"); got < 1 {
+		t.Fatalf("expected the gc cycles delta, got %d", got)
+	}
+	if got := recorder.Values("go.sched.goroutines_goroutines"); len(got) != 2 || got[0] < 1 {
+		t.Fatalf("unexpected goroutines: %v", got)
+	}
+}
+
+func TestAppendHistogram(t *testing.T) {
+	c := New(statoktest.NewRecorder(), Options{MaxHistogramSamples: 10})
+
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{0, 0, 0, 0},
+		Buckets: []float64{math.Inf(-1), 1e-6, 2e-6, 3e-6, math.Inf(1)},
+	}
+	if batch := c.appendHistogram(nil, "/test:seconds", "go.test_us", 1e6, h); len(batch) != 0 {
+		t.Fatalf("the first collection must be remembered only, got %v", batch)
+	}
+
+	h.Counts = []uint64{1000, 0, 3, 2}
+	batch := c.appendHistogram(nil, "/test:seconds", "go.test_us", 1e6, h)
+
+	if batch[0].MetricName != "go.test_us.count" || batch[0].Counter != 1005 {
+		t.Fatalf("unexpected count event: %+v", batch[0])
+	}
+	// The sparse buckets don't get a sample of their own, so the total stays within MaxHistogramSamples
+	values := batch[1:]
+	if len(values) != 10 {
+		t.Fatalf("expected 10 samples, got %d", len(values))
+	}
+	for _, e := range values {
+		if e.MetricName != "go.test_us" || math.Abs(float64(e.Value)-1) > 1e-6 {
+			t.Fatalf("unexpected sample: %+v", e)
+		}
+	}
+
+	// The deltas since the previous collection
+	h.Counts = []uint64{1000, 0, 5, 2}
+	batch = c.appendHistogram(nil, "/test:seconds", "go.test_us", 1e6, h)
+	if len(batch) != 3 || batch[0].Counter != 2 || math.Abs(float64(batch[1].Value)-2.5) > 1e-6 {
+		t.Fatalf("unexpected delta events: %+v", batch)
+	}
+}
+
+func TestCollectRejected(t *testing.T) {
+	// The goroutines metric is rejected, like the Client validation does with the too long names
+	recorder := statoktest.NewRecorder()
+	recorder.Reject(func(e statoktest.Event) error {
+		if e.MetricName == "go.sched.goroutines_goroutines" {
+			return &gostatok.ValidationError{Rule: gostatok.RuleNameTooLong, MetricName: e.MetricName, LabelIndex: -1}
+		}
+		return nil
+	})
+	c := New(recorder, Options{Filter: func(name string) bool {
+		return name == "/sched/goroutines:goroutines" || name == "/memory/classes/total:bytes"
+	}})
+	c.Collect()
+
+	// The rejected metric doesn't drop the others
+	if got := recorder.Values("go.memory.classes.total_bytes"); len(got) != 1 {
+		t.Fatalf("unexpected memory values: %v", got)
+	}
+	recorder.AssertNoEvents(t, "go.sched.goroutines_goroutines")
+	recorder.AssertCounterLabels(t, "go.rejected", gostatok.L("metric", "go.sched.goroutines_goroutines"), 1)
+}
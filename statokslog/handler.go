@@ -0,0 +1,138 @@
+// Package statokslog turns log/slog records into metrics sent through a gostatok.Client
+package statokslog
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+const defaultMetricName = "log_records"
+
+type Options struct {
+	// MetricName of the records counter, "log_records" by default. It is labelled by the "level" and,
+	// for the loggers with groups, by the dot separated "group".
+	MetricName string
+	// ValueAttrs maps the names of the numeric attributes to the names of the value metrics they are reported to,
+	// the attribute name is used if the metric name is empty. The attributes in groups are matched by
+	// the dot separated path, e.g. "http.duration_ms". Durations are reported in milliseconds.
+	ValueAttrs map[string]string
+}
+
+// Handler counts the log records and extracts the configured attributes as values,
+// then passes the records through to the wrapped handler
+type Handler struct {
+	next    slog.Handler
+	client  gostatok.Emitter
+	options *Options
+	group   string
+	// attrs are the WithAttrs attributes with their groups, the values are extracted from them for every record
+	attrs []groupedAttr
+}
+
+type groupedAttr struct {
+	group string
+	attr  slog.Attr
+}
+
+func NewHandler(next slog.Handler, client gostatok.Emitter, options Options) *Handler {
+	if options.MetricName == "" {
+		options.MetricName = defaultMetricName
+	}
+	return &Handler{next: next, client: client, options: &options}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	labels := gostatok.L("level", r.Level.String())
+	if h.group != "" {
+		labels = append(labels, gostatok.Label{Key: "group", Value: h.group})
+	}
+	h.client.EventLabels(h.options.MetricName, 1, labels)
+
+	for _, ga := range h.attrs {
+		h.extractValues(ga.group, ga.attr)
+	}
+	if len(h.options.ValueAttrs) > 0 {
+		r.Attrs(func(a slog.Attr) bool {
+			h.extractValues(h.group, a)
+			return true
+		})
+	}
+
+	return h.next.Handle(ctx, r)
+}
+
+func (h *Handler) extractValues(prefix string, a slog.Attr) {
+	key := a.Key
+	if prefix != "" {
+		key = prefix + "." + a.Key
+	}
+
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key == "" {
+			// Inlined group
+			key = prefix
+		}
+		for _, ga := range v.Group() {
+			h.extractValues(key, ga)
+		}
+		return
+	}
+
+	metricName, ok := h.options.ValueAttrs[key]
+	if !ok {
+		return
+	}
+	if metricName == "" {
+		metricName = key
+	}
+
+	var value float64
+	switch v.Kind() {
+	case slog.KindInt64:
+		value = float64(v.Int64())
+	case slog.KindUint64:
+		value = float64(v.Uint64())
+	case slog.KindFloat64:
+		value = v.Float64()
+	case slog.KindDuration:
+		value = v.Duration().Seconds() * 1000
+	default:
+		return
+	}
+	h.client.EventValue(metricName, float32(value))
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.next = h.next.WithAttrs(attrs)
+	if len(h.options.ValueAttrs) > 0 {
+		h2.attrs = slices.Clip(h.attrs)
+		for _, a := range attrs {
+			h2.attrs = append(h2.attrs, groupedAttr{group: h.group, attr: a})
+		}
+	}
+	return &h2
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.next = h.next.WithGroup(name)
+	if h.group != "" {
+		h2.group = h.group + "." + name
+	} else {
+		h2.group = name
+	}
+	return &h2
+}
@@ -0,0 +1,69 @@
+package statokslog
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+func TestHandler(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+	var out bytes.Buffer
+	logger := slog.New(NewHandler(slog.NewTextHandler(&out, nil), recorder, Options{
+		ValueAttrs: map[string]string{
+			"duration_ms":   "",
+			"elapsed":       "elapsed_ms",
+			"http.size":     "http_size",
+			"request.bytes": "",
+		},
+	}))
+
+	logger.Info("done", "duration_ms", 12, "elapsed", 1500*time.Microsecond, "name", "job")
+	logger.Warn("slow", "duration_ms", "not a number")
+	logger.WithGroup("http").Error("failed", "size", uint64(512))
+	logger.Info("inline", slog.Group("", slog.Int("duration_ms", 7)), slog.Group("request", slog.Float64("bytes", 2.5)))
+	logger.Debug("disabled", "duration_ms", 100)
+
+	recorder.AssertCounterLabels(t, "log_records", gostatok.L("level", "INFO"), 2)
+	recorder.AssertCounterLabels(t, "log_records", gostatok.L("level", "WARN"), 1)
+	recorder.AssertCounterLabels(t, "log_records", gostatok.L("level", "ERROR", "group", "http"), 1)
+	recorder.AssertCounterLabels(t, "log_records", gostatok.L("level", "DEBUG"), 0)
+
+	recorder.AssertValues(t, "duration_ms", nil, []float32{12, 7})
+	recorder.AssertValues(t, "elapsed_ms", nil, []float32{1.5})
+	recorder.AssertValues(t, "http_size", nil, []float32{512})
+	recorder.AssertValues(t, "request.bytes", nil, []float32{2.5})
+
+	if !strings.Contains(out.String(), "msg=done") || !strings.Contains(out.String(), "http.size=512") {
+		t.Fatalf("records are not passed through: %s", out.String())
+	}
+}
+
+func TestHandlerWithAttrs(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+	logger := slog.New(NewHandler(slog.NewTextHandler(&bytes.Buffer{}, nil), recorder, Options{
+		ValueAttrs: map[string]string{"duration_ms": "", "db.rows": "db_rows"},
+	}))
+
+	requestLogger := logger.With("duration_ms", 30*time.Millisecond)
+	requestLogger.Info("first")
+	requestLogger.Info("second", "duration_ms", 5)
+
+	// The attributes are matched by the group they were added in
+	dbLogger := logger.WithGroup("db").With("rows", 3)
+	dbLogger.Info("query")
+	dbLogger.With("duration_ms", 1).Info("nested")
+
+	// The parent logger is not affected
+	logger.Info("plain")
+
+	recorder.AssertValues(t, "duration_ms", nil, []float32{30, 30, 5})
+	recorder.AssertValues(t, "db_rows", nil, []float32{3, 3})
+	recorder.AssertCounterLabels(t, "log_records", gostatok.L("level", "INFO", "group", "db"), 2)
+	recorder.AssertCounterLabels(t, "log_records", gostatok.L("level", "INFO"), 3)
+}
@@ -0,0 +1,233 @@
+package statoksql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// connWrapper implements all the optional connection interfaces, falling back the way database/sql does
+// when the wrapped connection doesn't implement them
+type connWrapper struct {
+	base driver.Conn
+	rec  *recorder
+}
+
+func (c *connWrapper) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *connWrapper) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	start := time.Now()
+
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.base.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		if err = ctx.Err(); err == nil {
+			stmt, err = c.base.Prepare(query)
+		}
+	}
+
+	c.rec.record(OpPrepare, query, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &stmtWrapper{base: stmt, conn: c, query: query}, nil
+}
+
+func (c *connWrapper) Close() error {
+	return c.base.Close()
+}
+
+func (c *connWrapper) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *connWrapper) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+
+	var tx driver.Tx
+	var err error
+	if b, ok := c.base.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else if opts.Isolation != driver.IsolationLevel(0) || opts.ReadOnly {
+		err = errors.New("statoksql: driver does not support non-default transaction options")
+	} else if err = ctx.Err(); err == nil {
+		tx, err = c.base.Begin()
+	}
+
+	c.rec.record(OpBegin, "", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &txWrapper{base: tx, rec: c.rec, start: start}, nil
+}
+
+func (c *connWrapper) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.base.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	c.rec.record(OpQuery, query, start, err)
+	return rows, err
+}
+
+func (c *connWrapper) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.base.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	res, err := e.ExecContext(ctx, query, args)
+	c.rec.record(OpExec, query, start, err)
+	return res, err
+}
+
+func (c *connWrapper) Ping(ctx context.Context) error {
+	if p, ok := c.base.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *connWrapper) ResetSession(ctx context.Context) error {
+	if r, ok := c.base.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *connWrapper) IsValid() bool {
+	if v, ok := c.base.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *connWrapper) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := c.base.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type stmtWrapper struct {
+	base  driver.Stmt
+	conn  *connWrapper
+	query string
+}
+
+func (s *stmtWrapper) Close() error {
+	return s.base.Close()
+}
+
+func (s *stmtWrapper) NumInput() int {
+	return s.base.NumInput()
+}
+
+func (s *stmtWrapper) Exec(args []driver.Value) (driver.Result, error) {
+	start := time.Now()
+	res, err := s.base.Exec(args)
+	s.conn.rec.record(OpExec, s.query, start, err)
+	return res, err
+}
+
+func (s *stmtWrapper) Query(args []driver.Value) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.base.Query(args)
+	s.conn.rec.record(OpQuery, s.query, start, err)
+	return rows, err
+}
+
+func (s *stmtWrapper) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := s.base.(driver.StmtExecContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		return s.Exec(values)
+	}
+
+	start := time.Now()
+	res, err := e.ExecContext(ctx, args)
+	s.conn.rec.record(OpExec, s.query, start, err)
+	return res, err
+}
+
+func (s *stmtWrapper) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := s.base.(driver.StmtQueryContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		return s.Query(values)
+	}
+
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, args)
+	s.conn.rec.record(OpQuery, s.query, start, err)
+	return rows, err
+}
+
+func (s *stmtWrapper) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := s.base.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	if cc, ok := s.base.(driver.ColumnConverter); ok {
+		value, err := cc.ColumnConverter(nv.Ordinal - 1).ConvertValue(nv.Value)
+		if err != nil {
+			return err
+		}
+		nv.Value = value
+		return nil
+	}
+	return s.conn.CheckNamedValue(nv)
+}
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("statoksql: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+type txWrapper struct {
+	base  driver.Tx
+	rec   *recorder
+	start time.Time
+}
+
+func (t *txWrapper) Commit() error {
+	start := time.Now()
+	err := t.base.Commit()
+	t.rec.record(OpCommit, "", start, err)
+	t.rec.record(OpTx, "", t.start, err)
+	return err
+}
+
+func (t *txWrapper) Rollback() error {
+	start := time.Now()
+	err := t.base.Rollback()
+	t.rec.record(OpRollback, "", start, err)
+	t.rec.record(OpTx, "", t.start, err)
+	return err
+}
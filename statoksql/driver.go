@@ -0,0 +1,138 @@
+// Package statoksql records the latency and errors of database/sql queries through a gostatok.Client
+package statoksql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+const defaultPrefix = "sql"
+
+// Operations reported in the "op" label
+const (
+	OpQuery    = "query"
+	OpExec     = "exec"
+	OpPrepare  = "prepare"
+	OpBegin    = "begin"
+	OpCommit   = "commit"
+	OpRollback = "rollback"
+	// OpTx is the whole transaction, from begin to commit or rollback
+	OpTx = "tx"
+)
+
+type Options struct {
+	// Prefix of the metric names, "sql" by default:
+	//   <prefix>_duration_ms   latency of the operation
+	//   <prefix>_errors        counter of the failed operations
+	Prefix string
+	// QueryName extracts the "query" label from the query text. It must return a low cardinality value,
+	// e.g. a name from a leading comment. The label is not set if nil or an empty string is returned.
+	QueryName func(query string) string
+}
+
+type recorder struct {
+	client         gostatok.Emitter
+	options        Options
+	durationMetric string
+	errorsMetric   string
+}
+
+func newRecorder(client gostatok.Emitter, options Options) *recorder {
+	if options.Prefix == "" {
+		options.Prefix = defaultPrefix
+	}
+	return &recorder{
+		client:         client,
+		options:        options,
+		durationMetric: options.Prefix + "_duration_ms",
+		errorsMetric:   options.Prefix + "_errors",
+	}
+}
+
+func (r *recorder) record(op string, query string, start time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		// Not an error, database/sql falls back to another method, which is recorded separately
+		return
+	}
+
+	labels := gostatok.L("op", op)
+	if query != "" && r.options.QueryName != nil {
+		if name := r.options.QueryName(query); name != "" {
+			labels = append(labels, gostatok.Label{Key: "query", Value: name})
+		}
+	}
+
+	r.client.EventValueLabels(r.durationMetric, float32(time.Since(start).Seconds()*1000), labels)
+	if err != nil {
+		r.client.EventLabels(r.errorsMetric, 1, labels)
+	}
+}
+
+// WrapDriver returns the driver recording the metrics of the connections it opens.
+// Register it with sql.Register under a new name.
+func WrapDriver(d driver.Driver, client gostatok.Emitter, options Options) driver.Driver {
+	w := &driverWrapper{base: d, rec: newRecorder(client, options)}
+	if _, ok := d.(driver.DriverContext); ok {
+		return &driverContextWrapper{w}
+	}
+	return w
+}
+
+// WrapConnector returns the connector recording the metrics of the connections it opens
+func WrapConnector(c driver.Connector, client gostatok.Emitter, options Options) driver.Connector {
+	rec := newRecorder(client, options)
+	return &connectorWrapper{base: c, rec: rec, driver: &driverWrapper{base: c.Driver(), rec: rec}}
+}
+
+// OpenDB is sql.OpenDB with the wrapped connector
+func OpenDB(c driver.Connector, client gostatok.Emitter, options Options) *sql.DB {
+	return sql.OpenDB(WrapConnector(c, client, options))
+}
+
+type driverWrapper struct {
+	base driver.Driver
+	rec  *recorder
+}
+
+func (d *driverWrapper) Open(name string) (driver.Conn, error) {
+	conn, err := d.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &connWrapper{base: conn, rec: d.rec}, nil
+}
+
+type driverContextWrapper struct {
+	*driverWrapper
+}
+
+func (d *driverContextWrapper) OpenConnector(name string) (driver.Connector, error) {
+	c, err := d.base.(driver.DriverContext).OpenConnector(name)
+	if err != nil {
+		return nil, err
+	}
+	return &connectorWrapper{base: c, rec: d.rec, driver: d}, nil
+}
+
+type connectorWrapper struct {
+	base   driver.Connector
+	rec    *recorder
+	driver driver.Driver
+}
+
+func (c *connectorWrapper) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &connWrapper{base: conn, rec: c.rec}, nil
+}
+
+func (c *connectorWrapper) Driver() driver.Driver {
+	return c.driver
+}
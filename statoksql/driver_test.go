@@ -0,0 +1,132 @@
+package statoksql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+var errFakeQuery = errors.New("fake query error")
+
+// fakeDriver is an in-process driver without the optional interfaces, so the fallbacks are covered too
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeStmt struct{ query string }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.query == "fail" {
+		return nil, errFakeQuery
+	}
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.query == "fail" {
+		return nil, errFakeQuery
+	}
+	return &fakeRows{left: 2}, nil
+}
+
+type fakeRows struct{ left int }
+
+func (r *fakeRows) Columns() []string { return []string{"n"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		return io.EOF
+	}
+	dest[0] = int64(r.left)
+	r.left--
+	return nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+// fakeConnector opens the driver connections, like sql.Open does for the drivers without driver.DriverContext,
+// so the tests don't need sql.Register, which panics when called twice for the same name with -count
+type fakeConnector struct{ d driver.Driver }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c fakeConnector) Driver() driver.Driver                        { return c.d }
+
+func TestWrapDriver(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+	options := Options{QueryName: func(query string) string { return query }}
+
+	db := sql.OpenDB(fakeConnector{WrapDriver(fakeDriver{}, recorder, options)})
+	defer db.Close()
+	testDB(t, db, recorder)
+}
+
+func TestOpenDB(t *testing.T) {
+	recorder := statoktest.NewRecorder()
+	options := Options{QueryName: func(query string) string { return query }}
+
+	db := OpenDB(fakeConnector{fakeDriver{}}, recorder, options)
+	defer db.Close()
+	testDB(t, db, recorder)
+}
+
+func testDB(t *testing.T, db *sql.DB, recorder *statoktest.Recorder) {
+	t.Helper()
+
+	res, err := db.Exec("insert", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Fatalf("unexpected rows affected: %d", n)
+	}
+
+	rows, err := db.QueryContext(context.Background(), "select")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	_ = rows.Close()
+	if count != 2 {
+		t.Fatalf("unexpected rows count: %d", count)
+	}
+
+	if _, err = db.Exec("fail"); !errors.Is(err, errFakeQuery) {
+		t.Fatalf("expected the driver error, got %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder.AssertValueCount(t, "sql_duration_ms", gostatok.L("op", OpExec, "query", "insert"), 1)
+	recorder.AssertValueCount(t, "sql_duration_ms", gostatok.L("op", OpQuery, "query", "select"), 1)
+	recorder.AssertValueCount(t, "sql_duration_ms", gostatok.L("op", OpTx), 1)
+	recorder.AssertCounterLabels(t, "sql_errors", gostatok.L("op", OpExec, "query", "fail"), 1)
+	recorder.AssertCounterLabels(t, "sql_errors", gostatok.L("op", OpExec, "query", "insert"), 0)
+}
@@ -0,0 +1,63 @@
+package statoksql
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+const defaultStatsInterval = time.Second * 10
+
+// ExportDBStats periodically reports sql.DBStats of the db labelled by the name:
+//
+//	<prefix>_connections_open      gauge of the open connections
+//	<prefix>_connections_in_use    gauge of the connections in use
+//	<prefix>_connections_idle      gauge of the idle connections
+//	<prefix>_wait_count            counter of the connections waited for
+//	<prefix>_wait_duration_ms      time blocked waiting for a connection since the previous report
+//
+// The interval is 10 seconds by default. The returned function stops the export.
+func ExportDBStats(db *sql.DB, client gostatok.Emitter, prefix string, name string, interval time.Duration) (stop func()) {
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+	if interval <= 0 {
+		interval = defaultStatsInterval
+	}
+
+	labels := gostatok.L("db", name)
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		prev := db.Stats()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+
+			stats := db.Stats()
+			client.EventValueLabels(prefix+"_connections_open", float32(stats.OpenConnections), labels)
+			client.EventValueLabels(prefix+"_connections_in_use", float32(stats.InUse), labels)
+			client.EventValueLabels(prefix+"_connections_idle", float32(stats.Idle), labels)
+			if stats.WaitCount > prev.WaitCount {
+				client.EventLabels(prefix+"_wait_count", uint32(stats.WaitCount-prev.WaitCount), labels)
+				client.EventValueLabels(prefix+"_wait_duration_ms", float32((stats.WaitDuration-prev.WaitDuration).Seconds()*1000), labels)
+			}
+			prev = stats
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
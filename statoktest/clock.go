@@ -0,0 +1,97 @@
+package statoktest
+
+import (
+	"sync"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+// FakeClock is a manual gostatok.Clock, the time moves only with Advance and Set.
+// Like time.Ticker, its tickers drop the ticks the receiver is not ready for.
+type FakeClock struct {
+	mx      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+var _ gostatok.Clock = (*FakeClock)(nil)
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) gostatok.Ticker {
+	if d <= 0 {
+		panic("statoktest: non-positive interval for NewTicker")
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	t := &fakeTicker{clock: c, c: make(chan time.Time, 1), interval: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the time forward and fires the tickers which ticks have come
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mx.Lock()
+	c.setLocked(c.now.Add(d))
+	c.mx.Unlock()
+}
+
+// Set moves the time to the moment, which must not be before the current time
+func (c *FakeClock) Set(now time.Time) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if now.Before(c.now) {
+		panic("statoktest: the fake clock can't go backwards")
+	}
+	c.setLocked(now)
+}
+
+func (c *FakeClock) setLocked(now time.Time) {
+	c.now = now
+	for _, t := range c.tickers {
+		if t.next.After(now) {
+			continue
+		}
+		// The missed ticks are dropped, as the channel holds only one
+		select {
+		case t.c <- now:
+		default:
+		}
+		for !t.next.After(now) {
+			t.next = t.next.Add(t.interval)
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock    *FakeClock
+	c        chan time.Time
+	interval time.Duration
+	next     time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mx.Lock()
+	defer t.clock.mx.Unlock()
+	for i, ticker := range t.clock.tickers {
+		if ticker == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package statoktest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/decoder"
+)
+
+// IngestAccum is a decoded accum of the ingest payload
+type IngestAccum = decoder.Accum
+
+// IngestMetric is a decoded frame of the ingest payload
+type IngestMetric = decoder.Metric
+
+// IngestServer is a fake statok ingest API. It validates the Bearer API key or the request signature,
+// decodes the /i payloads according to their encoding headers and can be programmed to fail or delay the requests.
+type IngestServer struct {
+	server *httptest.Server
+	apiKey string
+
+	mx                sync.Mutex
+	metrics           []IngestMetric
+	requests          int
+	errors            []error
+	failures          []int
+	delay             time.Duration
+	onRequest         chan struct{}
+	requireSignatures bool
+	clock             gostatok.Clock
+	zstdDictionary    []byte
+	// The nonces of the signed requests by the time they were received, to reject the replays
+	nonces map[string]time.Time
+}
+
+// NewIngestServer starts the server accepting the API key
+func NewIngestServer(apiKey string) *IngestServer {
+	s := &IngestServer{
+		apiKey:    apiKey,
+		onRequest: make(chan struct{}, 1),
+		nonces:    make(map[string]time.Time),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// URL is the endpoint for gostatok.Options
+func (s *IngestServer) URL() string {
+	return s.server.URL
+}
+
+func (s *IngestServer) Close() {
+	s.server.Close()
+}
+
+// FailNext makes the next n requests respond with the status, e.g. 429 or 503
+func (s *IngestServer) FailNext(n int, status int) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for range n {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// SetDelay delays every response
+func (s *IngestServer) SetDelay(delay time.Duration) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.delay = delay
+}
+
+// RequireSignatures rejects the requests authorized with the Bearer API key instead of a signature,
+// see gostatok.Options.SignRequests
+func (s *IngestServer) RequireSignatures() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.requireSignatures = true
+}
+
+// SetClock sets the time the signature timestamps are verified against, e.g. the FakeClock of the client
+func (s *IngestServer) SetClock(clock gostatok.Clock) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.clock = clock
+}
+
+// SetZstdDictionary sets the dictionary of gostatok.Options.ZstdDictionary
+func (s *IngestServer) SetZstdDictionary(dictionary []byte) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.zstdDictionary = dictionary
+}
+
+// Metrics returns the metrics of all the accepted requests
+func (s *IngestServer) Metrics() []IngestMetric {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]IngestMetric(nil), s.metrics...)
+}
+
+// Requests returns the number of the received requests, including the failed ones
+func (s *IngestServer) Requests() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.requests
+}
+
+// Errors returns the errors of the rejected requests: authorization, framing or decoding
+func (s *IngestServer) Errors() []error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]error(nil), s.errors...)
+}
+
+// WaitMetric waits until the metric is received and returns its frames, failing the test on timeout
+func (s *IngestServer) WaitMetric(t testing.TB, name string, timeout time.Duration) []IngestMetric {
+	t.Helper()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		var found []IngestMetric
+		for _, m := range s.Metrics() {
+			if m.Name == name {
+				found = append(found, m)
+			}
+		}
+		if len(found) > 0 {
+			return found
+		}
+
+		select {
+		case <-s.onRequest:
+		case <-deadline.C:
+			t.Fatalf("statok metric %s was not received in %s, errors: %v", name, timeout, s.Errors())
+			return nil
+		}
+	}
+}
+
+func (s *IngestServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		select {
+		case s.onRequest <- struct{}{}:
+		default:
+		}
+	}()
+
+	s.mx.Lock()
+	s.requests++
+	delay := s.delay
+	failure := 0
+	if len(s.failures) > 0 {
+		failure = s.failures[0]
+		s.failures = s.failures[1:]
+	}
+	s.mx.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	if r.Method != http.MethodPost || r.URL.Path != "/i" {
+		s.reject(w, http.StatusNotFound, fmt.Errorf("unexpected request %s %s", r.Method, r.URL.Path))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.reject(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = s.authorize(r, body); err != nil {
+		s.reject(w, http.StatusUnauthorized, err)
+		return
+	}
+	if failure != 0 {
+		w.WriteHeader(failure)
+		return
+	}
+
+	options, err := decoder.OptionsFromHeader(r.Header)
+	if err != nil {
+		s.reject(w, http.StatusUnsupportedMediaType, err)
+		return
+	}
+	s.mx.Lock()
+	options.ZstdDictionary = s.zstdDictionary
+	s.mx.Unlock()
+
+	metrics, err := decoder.DecodeWith(body, options)
+	if err != nil {
+		s.reject(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mx.Lock()
+	s.metrics = append(s.metrics, metrics...)
+	s.mx.Unlock()
+}
+
+func (s *IngestServer) authorize(r *http.Request, body []byte) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if r.Header.Get(gostatok.HeaderSignature) == "" {
+		if s.requireSignatures {
+			return errors.New("unsigned request")
+		}
+		if r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+			return errors.New("invalid api key")
+		}
+		return nil
+	}
+
+	clientID, secret, _ := strings.Cut(s.apiKey, "_")
+	if r.Header.Get(gostatok.HeaderClientID) != clientID {
+		return errors.New("invalid client id")
+	}
+
+	now := time.Now()
+	if s.clock != nil {
+		now = s.clock.Now()
+	}
+	if err := gostatok.VerifySignature(r, body, secret, now); err != nil {
+		return err
+	}
+
+	for nonce, ts := range s.nonces {
+		if now.Sub(ts) > gostatok.MaxSignatureAge {
+			delete(s.nonces, nonce)
+		}
+	}
+	nonce := r.Header.Get(gostatok.HeaderNonce)
+	if _, ok := s.nonces[nonce]; ok {
+		return errors.New("replayed nonce")
+	}
+	s.nonces[nonce] = now
+	return nil
+}
+
+func (s *IngestServer) reject(w http.ResponseWriter, status int, err error) {
+	s.mx.Lock()
+	s.errors = append(s.errors, err)
+	s.mx.Unlock()
+	http.Error(w, err.Error(), status)
+}
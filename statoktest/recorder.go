@@ -0,0 +1,298 @@
+// Package statoktest helps to test the code instrumented with statok without the network
+package statoktest
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+// Event is an event recorded by Recorder
+type Event struct {
+	MetricName string
+	// LabelKeys are the canonical keys of the named labels, nil for the positional labels
+	LabelKeys []string
+	Labels    []string
+	Counter   uint32
+	Value     float32
+	IsValue   bool
+	// SampleRate is gostatok.BatchEvent.SampleRate, the events are recorded unscaled
+	SampleRate float32
+}
+
+// Accum is the aggregation of the recorded events of a series
+type Accum struct {
+	MetricName string
+	LabelKeys  []string
+	Labels     []string
+	// Counter is the sum of the counters, or the number of the values
+	Counter uint32
+	// Values are the values in the order they were recorded, nil for the counters
+	Values []float32
+}
+
+// Recorder implements gostatok.Emitter recording the events in memory. Like the Client, it ignores
+// zero counters and canonicalises the named labels, but it neither validates nor samples the events,
+// see Reject to make it reject some.
+type Recorder struct {
+	mx     sync.Mutex
+	events []Event
+	reject func(e Event) error
+}
+
+var _ gostatok.Emitter = (*Recorder)(nil)
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Reject makes the recorder reject the events the function returns an error for, e.g. a *gostatok.ValidationError
+// to test the handling of the Client validation. Like in the Client, a rejected event rejects its whole batch.
+func (r *Recorder) Reject(reject func(e Event) error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.reject = reject
+}
+
+func (r *Recorder) record(events ...Event) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if r.reject != nil {
+		for _, e := range events {
+			if err := r.reject(e); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range events {
+		if e.IsValue || e.Counter != 0 {
+			r.events = append(r.events, e)
+		}
+	}
+	return nil
+}
+
+// Events returns a copy of the recorded events
+func (r *Recorder) Events() []Event {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return slices.Clone(r.events)
+}
+
+// Reset forgets the recorded events
+func (r *Recorder) Reset() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.events = nil
+}
+
+// Accums aggregates the recorded events by the series, in the order the series were first recorded
+func (r *Recorder) Accums() []Accum {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	var accums []Accum
+	for _, e := range r.events {
+		i := slices.IndexFunc(accums, func(a Accum) bool {
+			return a.MetricName == e.MetricName && (a.Values != nil) == e.IsValue &&
+				slices.Equal(a.LabelKeys, e.LabelKeys) && slices.Equal(a.Labels, e.Labels)
+		})
+		if i < 0 {
+			accums = append(accums, Accum{MetricName: e.MetricName, LabelKeys: e.LabelKeys, Labels: e.Labels})
+			i = len(accums) - 1
+		}
+
+		if e.IsValue {
+			accums[i].Counter++
+			accums[i].Values = append(accums[i].Values, e.Value)
+		} else {
+			accums[i].Counter += e.Counter
+		}
+	}
+	return accums
+}
+
+func (r *Recorder) accum(metricName string, labelKeys, labels []string, isValue bool) (Accum, bool) {
+	for _, a := range r.Accums() {
+		if a.MetricName == metricName && (a.Values != nil) == isValue &&
+			slices.Equal(a.LabelKeys, labelKeys) && slices.Equal(a.Labels, labels) {
+			return a, true
+		}
+	}
+	return Accum{}, false
+}
+
+// Counter returns the sum of the counters of the series with the positional labels
+func (r *Recorder) Counter(metricName string, labels ...string) uint32 {
+	a, _ := r.accum(metricName, nil, labels, false)
+	return a.Counter
+}
+
+// CounterLabels returns the sum of the counters of the series with the named labels
+func (r *Recorder) CounterLabels(metricName string, labels gostatok.Labels) uint32 {
+	keys, values := labels.Split()
+	a, _ := r.accum(metricName, keys, values, false)
+	return a.Counter
+}
+
+// Values returns the values of the series with the positional labels
+func (r *Recorder) Values(metricName string, labels ...string) []float32 {
+	a, _ := r.accum(metricName, nil, labels, true)
+	return a.Values
+}
+
+// ValuesLabels returns the values of the series with the named labels
+func (r *Recorder) ValuesLabels(metricName string, labels gostatok.Labels) []float32 {
+	keys, values := labels.Split()
+	a, _ := r.accum(metricName, keys, values, true)
+	return a.Values
+}
+
+// AssertCounter fails the test if the sum of the counters of the series with the positional labels is not want
+func (r *Recorder) AssertCounter(t testing.TB, metricName string, labels []string, want uint32) {
+	t.Helper()
+	if got := r.Counter(metricName, labels...); got != want {
+		t.Errorf("statok counter %s%q = %d, want %d", metricName, labels, got, want)
+	}
+}
+
+// AssertCounterLabels fails the test if the sum of the counters of the series with the named labels is not want
+func (r *Recorder) AssertCounterLabels(t testing.TB, metricName string, labels gostatok.Labels, want uint32) {
+	t.Helper()
+	if got := r.CounterLabels(metricName, labels); got != want {
+		t.Errorf("statok counter %s%v = %d, want %d", metricName, labels, got, want)
+	}
+}
+
+// AssertValues fails the test if the values of the series with the positional labels are not want
+func (r *Recorder) AssertValues(t testing.TB, metricName string, labels []string, want []float32) {
+	t.Helper()
+	if got := r.Values(metricName, labels...); !slices.Equal(got, want) {
+		t.Errorf("statok values %s%q = %v, want %v", metricName, labels, got, want)
+	}
+}
+
+// AssertValueCount fails the test if the number of the values of the series with the named labels is not want
+func (r *Recorder) AssertValueCount(t testing.TB, metricName string, labels gostatok.Labels, want int) {
+	t.Helper()
+	if got := len(r.ValuesLabels(metricName, labels)); got != want {
+		t.Errorf("statok values count %s%v = %d, want %d", metricName, labels, got, want)
+	}
+}
+
+// AssertNoEvents fails the test if any event of the metric was recorded
+func (r *Recorder) AssertNoEvents(t testing.TB, metricName string) {
+	t.Helper()
+	for _, e := range r.Events() {
+		if e.MetricName == metricName {
+			t.Errorf("statok metric %s: unexpected event %+v", metricName, e)
+			return
+		}
+	}
+}
+
+func (r *Recorder) Event(metricName string, value uint32, labels ...string) {
+	_ = r.EventWithError(metricName, value, labels...)
+}
+
+func (r *Recorder) EventWithError(metricName string, value uint32, labels ...string) error {
+	return r.EventCtx(context.Background(), metricName, value, labels...)
+}
+
+func (r *Recorder) EventCtx(ctx context.Context, metricName string, value uint32, labels ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.record(Event{MetricName: metricName, Labels: labels, Counter: value})
+}
+
+func (r *Recorder) EventValue(metricName string, value float32, labels ...string) {
+	_ = r.EventValueWithError(metricName, value, labels...)
+}
+
+func (r *Recorder) EventValueWithError(metricName string, value float32, labels ...string) error {
+	return r.EventValueCtx(context.Background(), metricName, value, labels...)
+}
+
+func (r *Recorder) EventValueCtx(ctx context.Context, metricName string, value float32, labels ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.record(Event{MetricName: metricName, Labels: labels, Value: value, IsValue: true})
+}
+
+func (r *Recorder) EventLabels(metricName string, value uint32, labels gostatok.Labels) {
+	_ = r.EventLabelsWithError(metricName, value, labels)
+}
+
+func (r *Recorder) EventLabelsWithError(metricName string, value uint32, labels gostatok.Labels) error {
+	return r.EventLabelsCtx(context.Background(), metricName, value, labels)
+}
+
+func (r *Recorder) EventLabelsCtx(ctx context.Context, metricName string, value uint32, labels gostatok.Labels) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	keys, values := labels.Split()
+	return r.record(Event{MetricName: metricName, LabelKeys: keys, Labels: values, Counter: value})
+}
+
+func (r *Recorder) EventValueLabels(metricName string, value float32, labels gostatok.Labels) {
+	_ = r.EventValueLabelsWithError(metricName, value, labels)
+}
+
+func (r *Recorder) EventValueLabelsWithError(metricName string, value float32, labels gostatok.Labels) error {
+	return r.EventValueLabelsCtx(context.Background(), metricName, value, labels)
+}
+
+func (r *Recorder) EventValueLabelsCtx(ctx context.Context, metricName string, value float32, labels gostatok.Labels) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	keys, values := labels.Split()
+	return r.record(Event{MetricName: metricName, LabelKeys: keys, Labels: values, Value: value, IsValue: true})
+}
+
+func (r *Recorder) EventBatch(events []gostatok.BatchEvent) error {
+	return r.EventBatchCtx(context.Background(), events)
+}
+
+func (r *Recorder) EventBatchCtx(ctx context.Context, events []gostatok.BatchEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.record(batchEvents(events)...)
+}
+
+// EventBatchPartial records the events one by one, stopping at the first rejected one
+func (r *Recorder) EventBatchPartial(ctx context.Context, events []gostatok.BatchEvent) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	for i, e := range batchEvents(events) {
+		if err := r.record(e); err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+func batchEvents(events []gostatok.BatchEvent) []Event {
+	recorded := make([]Event, len(events))
+	for i, e := range events {
+		recorded[i] = Event{
+			MetricName: e.MetricName,
+			LabelKeys:  e.LabelKeys,
+			Labels:     e.Labels,
+			Counter:    e.Counter,
+			Value:      e.Value,
+			IsValue:    e.IsValue,
+			SampleRate: e.SampleRate,
+		}
+	}
+	return recorded
+}
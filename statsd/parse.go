@@ -0,0 +1,108 @@
+// Package statsd translates StatsD and DogStatsD datagrams into gostatok.Client events
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+type MetricType string
+
+const (
+	TypeCounter      MetricType = "c"
+	TypeGauge        MetricType = "g"
+	TypeTiming       MetricType = "ms"
+	TypeHistogram    MetricType = "h"
+	TypeDistribution MetricType = "d"
+	TypeSet          MetricType = "s"
+)
+
+// Metric is a parsed StatsD line
+type Metric struct {
+	Name string
+	Type MetricType
+	// Values are the raw values, DogStatsD allows several values per line, e.g. "name:1:2:3|ms".
+	// The set values are kept in RawValues only.
+	Values    []float64
+	RawValues []string
+	// IsRelative is set for the gauges with the explicit sign, e.g. "name:+5|g"
+	IsRelative bool
+	// SampleRate is 1 when not specified
+	SampleRate float64
+	// Tags are the DogStatsD tags, the tags without ':' get an empty value
+	Tags gostatok.Labels
+}
+
+// ParseError is returned for malformed lines, the Reason is a low cardinality label value
+type ParseError struct {
+	Reason string
+	Line   string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("statsd: %s: %q", e.Reason, e.Line)
+}
+
+// ParseLine parses a single StatsD line: <name>:<value>[:<value>...]|<type>[|@<rate>][|#<tag>,<tag>...].
+// Unknown DogStatsD sections, e.g. "|c:<container>" or "|T<timestamp>", are ignored.
+func ParseLine(line string) (Metric, error) {
+	m := Metric{SampleRate: 1}
+
+	sections := strings.Split(line, "|")
+	if len(sections) < 2 {
+		return m, &ParseError{"missing_type", line}
+	}
+
+	name, values, ok := strings.Cut(sections[0], ":")
+	if !ok || values == "" {
+		return m, &ParseError{"missing_value", line}
+	}
+	if name == "" {
+		return m, &ParseError{"missing_name", line}
+	}
+	m.Name = name
+
+	m.Type = MetricType(sections[1])
+	switch m.Type {
+	case TypeCounter, TypeGauge, TypeTiming, TypeHistogram, TypeDistribution, TypeSet:
+	default:
+		return m, &ParseError{"unknown_type", line}
+	}
+
+	m.RawValues = strings.Split(values, ":")
+	if m.Type != TypeSet {
+		m.Values = make([]float64, 0, len(m.RawValues))
+		for _, raw := range m.RawValues {
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return m, &ParseError{"invalid_value", line}
+			}
+			m.Values = append(m.Values, v)
+		}
+		m.IsRelative = m.Type == TypeGauge && (values[0] == '+' || values[0] == '-')
+	}
+
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return m, &ParseError{"invalid_sample_rate", line}
+			}
+			m.SampleRate = rate
+		case strings.HasPrefix(section, "#"):
+			for _, tag := range strings.Split(section[1:], ",") {
+				if tag == "" {
+					continue
+				}
+				key, value, _ := strings.Cut(tag, ":")
+				m.Tags = append(m.Tags, gostatok.Label{Key: key, Value: value})
+			}
+		}
+	}
+
+	return m, nil
+}
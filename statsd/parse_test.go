@@ -0,0 +1,60 @@
+package statsd
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+func TestParseLine(t *testing.T) {
+	m, err := ParseLine("page.views:1:2|c|@0.5|#env:prod,canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "page.views" || m.Type != TypeCounter || m.SampleRate != 0.5 {
+		t.Fatalf("unexpected metric: %+v", m)
+	}
+	if !slices.Equal(m.Values, []float64{1, 2}) {
+		t.Fatalf("unexpected values: %v", m.Values)
+	}
+	if !slices.Equal(m.Tags, gostatok.L("env", "prod", "canary", "")) {
+		t.Fatalf("unexpected tags: %v", m.Tags)
+	}
+
+	m, err = ParseLine("queue.size:-3|g|c:abc123|T1656581400")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsRelative || m.Values[0] != -3 {
+		t.Fatalf("unexpected gauge: %+v", m)
+	}
+
+	m, err = ParseLine("users:alice|s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Values != nil || !slices.Equal(m.RawValues, []string{"alice"}) {
+		t.Fatalf("unexpected set: %+v", m)
+	}
+}
+
+func TestParseLineErrors(t *testing.T) {
+	for line, reason := range map[string]string{
+		"name":            "missing_type",
+		"name|c":          "missing_value",
+		":1|c":            "missing_name",
+		"name:1|x":        "unknown_type",
+		"name:abc|ms":     "invalid_value",
+		"name:1|c|@2":     "invalid_sample_rate",
+		"name:1|c|@zero":  "invalid_sample_rate",
+		"name:1:abc|d|#a": "invalid_value",
+	} {
+		_, err := ParseLine(line)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Reason != reason {
+			t.Fatalf("%q: expected %s, got %v", line, reason, err)
+		}
+	}
+}
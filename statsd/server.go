@@ -0,0 +1,304 @@
+package statsd
+
+import (
+	"errors"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+)
+
+const defaultSelfMetricsPrefix = "statsd"
+const defaultGaugeTTL = time.Hour
+const defaultMaxGauges = 10000
+
+// The sets are flushed with the shortest step, so a unique value is counted once per step
+const setsFlushInterval = time.Duration(gostatok.Step10s) * time.Second
+
+const maxDatagramSize = 65535
+
+type Options struct {
+	// SelfMetricsPrefix of the server own metrics, "statsd" by default:
+	//   <prefix>.lines            counter of the lines received
+	//   <prefix>.parse_errors     counter of the malformed lines and the events rejected by the client validation,
+	//                             labelled by the reason, "invalid_name" or "invalid_tag" for the rejected ones
+	//   <prefix>.gauges_overflow  counter of the gauges of the new series not remembered above MaxGauges
+	SelfMetricsPrefix string
+	// GaugeTTL is how long the last value of a gauge series is remembered after its last update, 1h by default.
+	// A relative change of an evicted gauge starts from 0, like the first one.
+	GaugeTTL time.Duration
+	// MaxGauges limits the remembered gauge series, 10000 by default. The gauges of the new series above
+	// the limit are still sent, but their relative changes start from 0 every time.
+	MaxGauges int
+}
+
+// Server translates StatsD lines into Client events: counters to counters, gauges, timings, histograms and
+// distributions to values, and sets to counters of the unique values per 10s. The sample rate of the counters,
+// timings, histograms and distributions is passed to the client, which scales them like its own sampled events.
+type Server struct {
+	client  gostatok.Emitter
+	options Options
+
+	linesMetric          string
+	parseErrorsMetric    string
+	gaugesOverflowMetric string
+
+	mx     sync.Mutex
+	gauges map[string]*gauge
+	sets   map[string]*set
+
+	connsMx sync.Mutex
+	conns   []net.PacketConn
+	closed  bool
+	done    chan struct{}
+}
+
+type gauge struct {
+	value   float64
+	updated time.Time
+}
+
+type set struct {
+	name   string
+	tags   gostatok.Labels
+	values map[string]struct{}
+}
+
+func NewServer(client gostatok.Emitter, options Options) *Server {
+	if options.SelfMetricsPrefix == "" {
+		options.SelfMetricsPrefix = defaultSelfMetricsPrefix
+	}
+	if options.GaugeTTL <= 0 {
+		options.GaugeTTL = defaultGaugeTTL
+	}
+	if options.MaxGauges <= 0 {
+		options.MaxGauges = defaultMaxGauges
+	}
+
+	s := &Server{
+		client:               client,
+		options:              options,
+		linesMetric:          options.SelfMetricsPrefix + ".lines",
+		parseErrorsMetric:    options.SelfMetricsPrefix + ".parse_errors",
+		gaugesOverflowMetric: options.SelfMetricsPrefix + ".gauges_overflow",
+		gauges:               make(map[string]*gauge),
+		sets:                 make(map[string]*set),
+		done:                 make(chan struct{}),
+	}
+	go s.startSetsFlusher()
+	return s
+}
+
+// ListenAndServe listens on the "udp" or "unixgram" address and serves until Close is called
+func (s *Server) ListenAndServe(network, address string) error {
+	if network == "unixgram" {
+		// Remove the stale socket of the previous run
+		_ = os.Remove(address)
+	}
+
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(conn)
+}
+
+// Serve reads the datagrams from the connection until it or the server is closed
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.connsMx.Lock()
+	if s.closed {
+		s.connsMx.Unlock()
+		_ = conn.Close()
+		return net.ErrClosed
+	}
+	s.conns = append(s.conns, conn)
+	s.connsMx.Unlock()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if n > 0 {
+			s.HandlePacket(buf[:n])
+		}
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Close closes the connections and flushes the sets
+func (s *Server) Close() error {
+	s.connsMx.Lock()
+	defer s.connsMx.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+
+	var errs []error
+	for _, conn := range s.conns {
+		errs = append(errs, conn.Close())
+	}
+	s.flushSets()
+	return errors.Join(errs...)
+}
+
+// HandlePacket handles a datagram of newline separated lines
+func (s *Server) HandlePacket(data []byte) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		s.HandleLine(line)
+	}
+}
+
+// HandleLine parses a single line and sends it to the client, the malformed lines are counted by reason
+func (s *Server) HandleLine(line string) {
+	s.client.Event(s.linesMetric, 1)
+
+	m, err := ParseLine(line)
+	if err != nil {
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) {
+			s.client.EventLabels(s.parseErrorsMetric, 1, gostatok.L("reason", parseErr.Reason))
+		}
+		return
+	}
+
+	switch m.Type {
+	case TypeCounter:
+		for _, v := range m.Values {
+			if v < 0 {
+				s.client.EventLabels(s.parseErrorsMetric, 1, gostatok.L("reason", "negative_counter"))
+				continue
+			}
+			s.send(m, gostatok.CounterEventLabels(m.Name, uint32(min(math.Round(v), math.MaxUint32)), m.Tags))
+		}
+	case TypeGauge:
+		s.handleGauge(m)
+	case TypeTiming, TypeHistogram, TypeDistribution:
+		for _, v := range m.Values {
+			s.send(m, gostatok.ValueEventLabels(m.Name, float32(v), m.Tags))
+		}
+	case TypeSet:
+		s.handleSet(m)
+	}
+}
+
+// send sends the event of the line with its sample rate, the events rejected by the validation are counted
+func (s *Server) send(m Metric, e gostatok.BatchEvent) {
+	if m.SampleRate < 1 {
+		e.SampleRate = float32(m.SampleRate)
+	}
+
+	var validationErr *gostatok.ValidationError
+	if err := s.client.EventBatch([]gostatok.BatchEvent{e}); errors.As(err, &validationErr) {
+		reason := "invalid_tag"
+		if validationErr.LabelIndex < 0 {
+			reason = "invalid_name"
+		}
+		s.client.EventLabels(s.parseErrorsMetric, 1, gostatok.L("reason", reason))
+	}
+}
+
+func seriesKey(m Metric) string {
+	keys, values := m.Tags.Split()
+	return m.Name + "\x00" + strings.Join(keys, "\x00") + "\x00" + strings.Join(values, "\x00")
+}
+
+func (s *Server) handleGauge(m Metric) {
+	s.mx.Lock()
+	key := seriesKey(m)
+	g := s.gauges[key]
+	var value float64
+	if g != nil {
+		value = g.value
+	}
+	for _, v := range m.Values {
+		if m.IsRelative {
+			value += v
+		} else {
+			value = v
+		}
+	}
+
+	overflow := false
+	switch {
+	case g != nil:
+		g.value, g.updated = value, time.Now()
+	case len(s.gauges) < s.options.MaxGauges:
+		s.gauges[key] = &gauge{value: value, updated: time.Now()}
+	default:
+		overflow = true
+	}
+	s.mx.Unlock()
+
+	if overflow {
+		s.client.Event(s.gaugesOverflowMetric, 1)
+	}
+	s.send(m, gostatok.ValueEventLabels(m.Name, float32(value), m.Tags))
+}
+
+func (s *Server) handleSet(m Metric) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	key := seriesKey(m)
+	st := s.sets[key]
+	if st == nil {
+		st = &set{name: m.Name, tags: m.Tags, values: make(map[string]struct{})}
+		s.sets[key] = st
+	}
+	for _, v := range m.RawValues {
+		st.values[v] = struct{}{}
+	}
+}
+
+func (s *Server) startSetsFlusher() {
+	ticker := time.NewTicker(setsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.flushSets()
+			s.evictGauges(now)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Server) flushSets() {
+	s.mx.Lock()
+	sets := s.sets
+	s.sets = make(map[string]*set)
+	s.mx.Unlock()
+
+	for _, st := range sets {
+		s.send(Metric{Name: st.name, Tags: st.tags, SampleRate: 1}, gostatok.CounterEventLabels(st.name, uint32(len(st.values)), st.tags))
+	}
+}
+
+// evictGauges forgets the gauges not updated for GaugeTTL
+func (s *Server) evictGauges(now time.Time) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for key, g := range s.gauges {
+		if now.Sub(g.updated) > s.options.GaugeTTL {
+			delete(s.gauges, key)
+		}
+	}
+}
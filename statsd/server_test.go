@@ -0,0 +1,145 @@
+package statsd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	gostatok "github.com/statxyz/statok-go"
+	"github.com/statxyz/statok-go/statoktest"
+)
+
+func newTestServer(t *testing.T, options Options) (*Server, *statoktest.Recorder) {
+	recorder := statoktest.NewRecorder()
+	s := NewServer(recorder, options)
+	t.Cleanup(func() { _ = s.Close() })
+	return s, recorder
+}
+
+func TestServerCounters(t *testing.T) {
+	s, recorder := newTestServer(t, Options{})
+
+	s.HandlePacket([]byte("hits:3|c|@0.5\nhits:1|c\n\nhits:2|c|#env:prod\nhits:-1|c"))
+
+	// The sample rate is passed to the client, which scales the counters
+	recorder.AssertCounter(t, "hits", nil, 4)
+	assertSampleRates(t, recorder, "hits", 0.5, 0, 0)
+	recorder.AssertCounterLabels(t, "hits", gostatok.L("env", "prod"), 2)
+	recorder.AssertCounter(t, "statsd.lines", nil, 4)
+	recorder.AssertCounterLabels(t, "statsd.parse_errors", gostatok.L("reason", "negative_counter"), 1)
+}
+
+func TestServerValues(t *testing.T) {
+	s, recorder := newTestServer(t, Options{})
+
+	s.HandleLine("latency:1.5:2.5|ms")
+	s.HandleLine("size:10|h|@0.1")
+	s.HandleLine("load:3|d")
+
+	// The values are not scaled, but their sample rate is passed to the client to scale their count
+	recorder.AssertValues(t, "latency", nil, []float32{1.5, 2.5})
+	recorder.AssertValues(t, "size", nil, []float32{10})
+	assertSampleRates(t, recorder, "size", 0.1)
+	recorder.AssertValues(t, "load", nil, []float32{3})
+}
+
+func TestServerRejected(t *testing.T) {
+	s, recorder := newTestServer(t, Options{})
+	// The '/' in the tag keys is rejected, like the Client validation does
+	recorder.Reject(func(e statoktest.Event) error {
+		for i, key := range e.LabelKeys {
+			if strings.Contains(key, "/") {
+				return &gostatok.ValidationError{Rule: gostatok.RuleLabelChars, MetricName: e.MetricName, LabelIndex: i, IsLabelKey: true}
+			}
+		}
+		return nil
+	})
+
+	s.HandleLine("hits:1|c|#app.kubernetes.io/name:api")
+	s.HandleLine("hits:1|c|#app:api")
+
+	recorder.AssertCounterLabels(t, "hits", gostatok.L("app", "api"), 1)
+	recorder.AssertCounterLabels(t, "statsd.parse_errors", gostatok.L("reason", "invalid_tag"), 1)
+}
+
+func assertSampleRates(t *testing.T, recorder *statoktest.Recorder, metricName string, want ...float32) {
+	t.Helper()
+	var got []float32
+	for _, e := range recorder.Events() {
+		if e.MetricName == metricName {
+			got = append(got, e.SampleRate)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("%s sample rates = %v, want %v", metricName, got, want)
+	}
+}
+
+func TestServerGauges(t *testing.T) {
+	s, recorder := newTestServer(t, Options{})
+
+	for _, line := range []string{"queue:10|g", "queue:+5|g", "queue:-3|g", "queue:4|g", "queue:1|g|#env:prod", "queue:+1|g|#env:prod"} {
+		s.HandleLine(line)
+	}
+
+	recorder.AssertValues(t, "queue", nil, []float32{10, 15, 12, 4})
+	if got := recorder.ValuesLabels("queue", gostatok.L("env", "prod")); len(got) != 2 || got[1] != 2 {
+		t.Fatalf("unexpected tagged gauge values: %v", got)
+	}
+}
+
+func TestServerGaugesEviction(t *testing.T) {
+	s, recorder := newTestServer(t, Options{MaxGauges: 1, GaugeTTL: time.Minute})
+
+	s.HandleLine("a:5|g")
+	// Above MaxGauges the new series are sent, but not remembered
+	s.HandleLine("b:5|g")
+	s.HandleLine("b:+1|g")
+	recorder.AssertValues(t, "b", nil, []float32{5, 1})
+	recorder.AssertCounter(t, "statsd.gauges_overflow", nil, 2)
+
+	s.evictGauges(time.Now())
+	s.HandleLine("a:+1|g")
+	recorder.AssertValues(t, "a", nil, []float32{5, 6})
+
+	// The expired gauge starts from 0
+	s.evictGauges(time.Now().Add(2 * time.Minute))
+	s.HandleLine("a:+1|g")
+	recorder.AssertValues(t, "a", nil, []float32{5, 6, 1})
+	if len(s.gauges) != 1 {
+		t.Fatalf("expected 1 gauge, got %d", len(s.gauges))
+	}
+}
+
+func TestServerSets(t *testing.T) {
+	s, recorder := newTestServer(t, Options{})
+
+	s.HandlePacket([]byte("users:alice|s\nusers:bob|s\nusers:alice|s\nusers:carol|s|#env:prod"))
+	recorder.AssertNoEvents(t, "users")
+
+	// The unique values are counted on flush
+	s.flushSets()
+	recorder.AssertCounter(t, "users", nil, 2)
+	recorder.AssertCounterLabels(t, "users", gostatok.L("env", "prod"), 1)
+
+	s.HandleLine("users:alice|s")
+	s.flushSets()
+	recorder.AssertCounter(t, "users", nil, 3)
+
+	// Nothing is left to flush on Close
+	_ = s.Close()
+	recorder.AssertCounter(t, "users", nil, 3)
+}
+
+func TestServerParseErrors(t *testing.T) {
+	s, recorder := newTestServer(t, Options{SelfMetricsPrefix: "self"})
+
+	s.HandlePacket([]byte("name\nname:abc|ms\nname:1|x\nname:2|ms"))
+
+	recorder.AssertCounter(t, "self.lines", nil, 4)
+	recorder.AssertCounterLabels(t, "self.parse_errors", gostatok.L("reason", "missing_type"), 1)
+	recorder.AssertCounterLabels(t, "self.parse_errors", gostatok.L("reason", "invalid_value"), 1)
+	recorder.AssertCounterLabels(t, "self.parse_errors", gostatok.L("reason", "unknown_type"), 1)
+	recorder.AssertValues(t, "name", nil, []float32{2})
+}
@@ -56,3 +56,11 @@ func (sm *SyncMap[K, V]) Range(f func(key K, value V) bool) {
 }
 
 func (sm *SyncMap[K, V]) Set(key K, value V) { sm.m.Store(key, value) }
+
+func (sm *SyncMap[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	p, loaded := sm.m.Swap(key, value)
+	if !loaded {
+		return previous, loaded
+	}
+	return p.(V), loaded
+}
@@ -0,0 +1,222 @@
+package gostatok
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ValidationPolicy defines what happens with the events which metric name or labels violate the validation rules
+type ValidationPolicy uint8
+
+const (
+	// ValidationReject drops the invalid event and returns a *ValidationError
+	ValidationReject ValidationPolicy = iota
+	// ValidationSanitize fixes the invalid metric name and labels: replaces the disallowed characters with '_'
+	// and truncates what is too long. The events which can't be fixed are rejected.
+	ValidationSanitize
+	// ValidationPassThrough disables the validation, except for the checks the wire framing depends on:
+	// an empty metric name, a comma in the metric name and the label keys count mismatch
+	ValidationPassThrough
+)
+
+const (
+	defaultMaxMetricNameLength = 128
+	defaultMaxLabels           = 16
+	defaultMaxLabelLength      = 256
+)
+
+// ValidationRule is the rule violated by an event, see ValidationError
+type ValidationRule uint8
+
+const (
+	RuleNameEmpty ValidationRule = iota
+	RuleNameTooLong
+	RuleNameChars
+	RuleTooManyLabels
+	RuleLabelTooLong
+	RuleLabelChars
+	RuleLabelInvalidUTF8
+	RuleLabelKeysMismatch
+)
+
+func (r ValidationRule) String() string {
+	switch r {
+	case RuleNameEmpty:
+		return "metric name is empty"
+	case RuleNameTooLong:
+		return "metric name is too long"
+	case RuleNameChars:
+		return "metric name has disallowed characters, only [a-zA-Z0-9_.:-] are allowed"
+	case RuleTooManyLabels:
+		return "too many labels"
+	case RuleLabelTooLong:
+		return "label is too long"
+	case RuleLabelChars:
+		return "label has disallowed characters, quotes, backslashes and control characters are not allowed"
+	case RuleLabelInvalidUTF8:
+		return "label is not valid UTF-8"
+	case RuleLabelKeysMismatch:
+		return "label keys count doesn't match labels count"
+	default:
+		return "unknown rule"
+	}
+}
+
+// ValidationError is returned for the events rejected by the validation
+type ValidationError struct {
+	Rule       ValidationRule
+	MetricName string
+	// LabelIndex is the index of the violating label, -1 if the rule is not about a specific label
+	LabelIndex int
+	// IsLabelKey is set when the violating label is the key of a named label
+	IsLabelKey bool
+}
+
+func (e *ValidationError) Error() string {
+	if e.LabelIndex < 0 {
+		return fmt.Sprintf("statok: invalid metric %q: %s", e.MetricName, e.Rule)
+	}
+	if e.IsLabelKey {
+		return fmt.Sprintf("statok: invalid metric %q label key #%d: %s", e.MetricName, e.LabelIndex, e.Rule)
+	}
+	return fmt.Sprintf("statok: invalid metric %q label #%d: %s", e.MetricName, e.LabelIndex, e.Rule)
+}
+
+type validator struct {
+	policy              ValidationPolicy
+	maxMetricNameLength int
+	maxLabels           int
+	maxLabelLength      int
+}
+
+func isMetricNameChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == ':' || r == '-'
+}
+
+func isLabelChar(r rune) bool {
+	return r != '"' && r != '\\' && !unicode.IsControl(r)
+}
+
+// validate checks the event against the rules and returns the metric name and labels to use, which are
+// different from the passed ones only if they were sanitized
+func (v *validator) validate(metricName string, labelKeys, labels []string) (string, []string, []string, error) {
+	if labelKeys != nil && len(labelKeys) != len(labels) {
+		return metricName, labelKeys, labels, &ValidationError{RuleLabelKeysMismatch, metricName, -1, false}
+	}
+
+	if metricName == "" {
+		return metricName, labelKeys, labels, &ValidationError{RuleNameEmpty, metricName, -1, false}
+	}
+
+	if v.policy == ValidationPassThrough {
+		// The metric name is the comma separated field of the frame
+		if strings.IndexByte(metricName, ',') >= 0 {
+			return metricName, labelKeys, labels, &ValidationError{RuleNameChars, metricName, -1, false}
+		}
+		return metricName, labelKeys, labels, nil
+	}
+
+	if rule, ok := v.checkMetricName(metricName); !ok {
+		if v.policy != ValidationSanitize {
+			return metricName, labelKeys, labels, &ValidationError{rule, metricName, -1, false}
+		}
+		metricName = v.sanitize(metricName, v.maxMetricNameLength, isMetricNameChar)
+	}
+
+	if len(labels) > v.maxLabels {
+		if v.policy != ValidationSanitize {
+			return metricName, labelKeys, labels, &ValidationError{RuleTooManyLabels, metricName, -1, false}
+		}
+		labels = labels[:v.maxLabels]
+		if labelKeys != nil {
+			labelKeys = labelKeys[:v.maxLabels]
+		}
+	}
+
+	var err error
+	if labelKeys, err = v.checkLabels(metricName, labelKeys, true); err != nil {
+		return metricName, labelKeys, labels, err
+	}
+	if labels, err = v.checkLabels(metricName, labels, false); err != nil {
+		return metricName, labelKeys, labels, err
+	}
+
+	return metricName, labelKeys, labels, nil
+}
+
+func (v *validator) checkMetricName(metricName string) (ValidationRule, bool) {
+	if len(metricName) > v.maxMetricNameLength {
+		return RuleNameTooLong, false
+	}
+	for _, r := range metricName {
+		if !isMetricNameChar(r) {
+			return RuleNameChars, false
+		}
+	}
+	return 0, true
+}
+
+func (v *validator) checkLabel(label string, isKey bool) (ValidationRule, bool) {
+	if len(label) > v.maxLabelLength {
+		return RuleLabelTooLong, false
+	}
+	if !utf8.ValidString(label) {
+		return RuleLabelInvalidUTF8, false
+	}
+
+	isAllowed := isLabelChar
+	if isKey {
+		isAllowed = isMetricNameChar
+	}
+	for _, r := range label {
+		if !isAllowed(r) {
+			return RuleLabelChars, false
+		}
+	}
+	return 0, true
+}
+
+func (v *validator) checkLabels(metricName string, labels []string, isKeys bool) ([]string, error) {
+	sanitized := false
+	for i, label := range labels {
+		rule, ok := v.checkLabel(label, isKeys)
+		if ok {
+			continue
+		}
+		if v.policy != ValidationSanitize {
+			return labels, &ValidationError{rule, metricName, i, isKeys}
+		}
+
+		if !sanitized {
+			// Never modify the caller's slice
+			labels = append([]string(nil), labels...)
+			sanitized = true
+		}
+		if isKeys {
+			labels[i] = v.sanitize(label, v.maxLabelLength, isMetricNameChar)
+		} else {
+			labels[i] = v.sanitize(label, v.maxLabelLength, isLabelChar)
+		}
+	}
+	return labels, nil
+}
+
+// sanitize replaces the disallowed characters and invalid UTF-8 with '_' and truncates the string to
+// maxLength bytes, keeping it valid UTF-8
+func (v *validator) sanitize(s string, maxLength int, isAllowed func(rune) bool) string {
+	var sb strings.Builder
+	sb.Grow(min(len(s), maxLength))
+
+	for _, r := range s {
+		if r == utf8.RuneError || !isAllowed(r) {
+			r = '_'
+		}
+		if sb.Len()+utf8.RuneLen(r) > maxLength {
+			break
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,102 @@
+package gostatok
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestValidateReject(t *testing.T) {
+	v := validator{ValidationReject, 16, 2, 8}
+
+	cases := []struct {
+		name   string
+		labels []string
+		rule   ValidationRule
+		label  int
+	}{
+		{"", nil, RuleNameEmpty, -1},
+		{"too_long_metric_name", nil, RuleNameTooLong, -1},
+		{"bad,name", nil, RuleNameChars, -1},
+		{"m", []string{"a", "b", "c"}, RuleTooManyLabels, -1},
+		{"m", []string{"a", "too long label"}, RuleLabelTooLong, 1},
+		{"m", []string{`a"b`}, RuleLabelChars, 0},
+		{"m", []string{"\xff"}, RuleLabelInvalidUTF8, 0},
+	}
+
+	for _, tc := range cases {
+		_, _, _, err := v.validate(tc.name, nil, tc.labels)
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("%q %v: expected ValidationError, got %v", tc.name, tc.labels, err)
+		}
+		if verr.Rule != tc.rule || verr.LabelIndex != tc.label {
+			t.Fatalf("%q %v: unexpected error %v", tc.name, tc.labels, err)
+		}
+	}
+
+	if _, _, _, err := v.validate("ok.name:1-2", nil, []string{"значение"}); err == nil {
+		t.Fatalf("label too long in bytes must be rejected")
+	}
+	if _, _, _, err := v.validate("ok.name:1-2", nil, []string{"ok"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateSanitize(t *testing.T) {
+	v := validator{ValidationSanitize, 8, 2, 4}
+
+	labels := []string{`a"\b`, "ёжик", "c"}
+	name, _, sanitized, err := v.validate("bad name,too long", nil, labels)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name != "bad_name" {
+		t.Fatalf("unexpected name: %q", name)
+	}
+	if !slices.Equal(sanitized, []string{"a__b", "ёж"}) {
+		t.Fatalf("unexpected labels: %q", sanitized)
+	}
+	if labels[0] != `a"\b` {
+		t.Fatalf("caller's labels must not be modified")
+	}
+}
+
+func TestValidatePassThroughFraming(t *testing.T) {
+	v := validator{ValidationPassThrough, 16, 2, 8}
+
+	for _, name := range []string{"", "bad,name"} {
+		if _, _, _, err := v.validate(name, nil, nil); err == nil {
+			t.Errorf("%q must be rejected even in the pass through mode", name)
+		}
+	}
+	if _, _, _, err := v.validate("m", []string{"k"}, nil); err == nil {
+		t.Error("label keys mismatch must be rejected even in the pass through mode")
+	}
+	if _, _, _, err := v.validate("any name!", nil, []string{`"quoted"`, "very long label", "third"}); err != nil {
+		t.Errorf("unexpected error in the pass through mode: %v", err)
+	}
+}
+
+func TestSerializeEscapesLabels(t *testing.T) {
+	c := newTestClient(t, Options{Codec: CodecNone})
+	labelKeys := []string{`k"ey`, "k2"}
+	labels := []string{`a"b\c`, "line\nbreak\x01\xff"}
+	c.collectEvent(eventEntry{metricName: "m", labelKeys: labelKeys, labels: labels, counter: 1, ts: 1_700_000_000})
+
+	// <client id>,<metric name>,<payload length>,<payload>
+	payload := bytes.SplitN(c.serializeAccums(true).data.Bytes(), []byte(","), 4)[3]
+
+	var accums []struct {
+		K []string `json:"k"`
+		L []string `json:"l"`
+	}
+	if err := json.Unmarshal(payload, &accums); err != nil {
+		t.Fatalf("invalid JSON %s: %v", payload, err)
+	}
+	if !slices.Equal(accums[0].K, labelKeys) || !slices.Equal(accums[0].L, []string{`a"b\c`, "line\nbreak\x01�"}) {
+		t.Fatalf("labels weren't preserved: %+v", accums[0])
+	}
+}